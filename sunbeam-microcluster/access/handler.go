@@ -99,3 +99,17 @@ func ClusterCATrustedEndpoint(handler func(state *state.State, r *http.Request)
 		ProxyTarget:    proxyTarget,
 	}
 }
+
+// RequestActor returns the principal performing the request, used for audit attribution.
+// Requests over the unix socket are attributed to "local", TLS requests to the client certificate subject.
+func RequestActor(r *http.Request) string {
+	if r.RemoteAddr == "@" {
+		return "local"
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	return ""
+}
@@ -57,7 +57,7 @@ func cmdConfigPut(s *state.State, r *http.Request) response.Response {
 
 	err = sunbeam.UpdateConfig(s, key, body.String())
 	if err != nil {
-		return response.InternalError(err)
+		return response.SmartError(err)
 	}
 
 	return response.EmptySyncResponse
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/canonical/lxd/lxd/response"
+	"github.com/canonical/lxd/lxd/util"
+)
+
+// etagResponse returns a sync response for data carrying the ETag of etagData, or a 304 Not Modified response
+// when the request's If-None-Match header already holds that ETag.
+// The ETag is the hash of etagData, which is data without the fields computed at request time, so any write that
+// changes the result also changes the ETag.
+func etagResponse(r *http.Request, data any, etagData any) response.Response {
+	etag, err := util.EtagHash(etagData)
+	if err != nil {
+		return response.InternalError(err)
+	}
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match != "*" && strings.Trim(match, "\"") != etag {
+			continue
+		}
+
+		return response.ManualResponse(func(w http.ResponseWriter) error {
+			w.Header().Set("ETag", fmt.Sprintf("\"%s\"", etag))
+			w.WriteHeader(http.StatusNotModified)
+
+			return nil
+		})
+	}
+
+	return response.SyncResponseETag(true, data, etagData)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/lxd/response"
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/sunbeam"
+)
+
+// featureGated wraps handler so that requests get a 501 response unless the experimental feature is enabled.
+// The gate is checked on every request.
+func featureGated(feature string, handler func(s *state.State, r *http.Request) response.Response) func(s *state.State, r *http.Request) response.Response {
+	return func(s *state.State, r *http.Request) response.Response {
+		enabled, err := sunbeam.FeatureEnabled(s, feature)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		if !enabled {
+			return response.NotImplemented(fmt.Errorf("%q is experimental, set config key %q to true to enable it", r.URL.Path, feature))
+		}
+
+		return handler(s, r)
+	}
+}
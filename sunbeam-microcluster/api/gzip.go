@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/canonical/lxd/lxd/response"
+)
+
+// gzipMinSize is the response body size from which responses are compressed.
+const gzipMinSize = 16 * 1024
+
+// gzipResponse compresses the rendered body of resp when the client accepts gzip and the body is large enough
+// for compression to pay off.
+type gzipResponse struct {
+	r    *http.Request
+	resp response.Response
+}
+
+// bufferedResponseWriter records the status, headers and body written to it.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header returns the recorded headers.
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+// Write records body data.
+func (b *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	return b.body.Write(data)
+}
+
+// WriteHeader records the status code.
+func (b *bufferedResponseWriter) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header lists gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(encoding), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Render renders the wrapped response, compressing it if needed.
+func (g *gzipResponse) Render(w http.ResponseWriter) error {
+	if !acceptsGzip(g.r) {
+		return g.resp.Render(w)
+	}
+
+	buf := &bufferedResponseWriter{header: http.Header{}}
+	err := g.resp.Render(buf)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range buf.header {
+		w.Header()[key] = values
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if buf.status == 0 {
+		buf.status = http.StatusOK
+	}
+
+	if buf.body.Len() < gzipMinSize {
+		w.WriteHeader(buf.status)
+		_, err = w.Write(buf.body.Bytes())
+
+		return err
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(buf.status)
+
+	gw := gzip.NewWriter(w)
+	_, err = gw.Write(buf.body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// String returns the description of the wrapped response.
+func (g *gzipResponse) String() string {
+	return g.resp.String()
+}
@@ -1,18 +1,24 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/canonical/lxd/lxd/response"
-	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/lxd/shared"
 	"github.com/canonical/microcluster/rest"
 	"github.com/canonical/microcluster/state"
 	"github.com/gorilla/mux"
 
 	"github.com/canonical/snap-openstack/sunbeam-microcluster/access"
 	"github.com/canonical/snap-openstack/sunbeam-microcluster/api/types"
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
 	"github.com/canonical/snap-openstack/sunbeam-microcluster/sunbeam"
 )
 
@@ -21,70 +27,368 @@ var jujuusersCmd = rest.Endpoint{
 	Path: "jujuusers",
 
 	Get:  access.ClusterCATrustedEndpoint(cmdJujuUsersGetAll, true),
-	Post: access.ClusterCATrustedEndpoint(cmdJujuUsersPost, true),
+	Post: access.ClusterCATrustedEndpoint(rateLimited(writeLimiter, cmdJujuUsersPost), true),
+}
+
+// /1.0/jujuusers/batch endpoint.
+// It is experimental and only available once enabled, see sunbeam.ExperimentalJujuUserBatch.
+var jujuusersBatchCmd = rest.Endpoint{
+	Path: "jujuusers/batch",
+
+	Post: access.ClusterCATrustedEndpoint(featureGated(sunbeam.ExperimentalJujuUserBatch, rateLimited(writeLimiter, cmdJujuUsersBatchPost)), true),
+}
+
+// /1.0/jujuusers/stats endpoint.
+var jujuusersStatsCmd = rest.Endpoint{
+	Path: "jujuusers/stats",
+
+	Get: access.ClusterCATrustedEndpoint(cmdJujuUsersStatsGet, true),
+}
+
+// /1.0/jujuusers/metrics endpoint.
+var jujuusersMetricsCmd = rest.Endpoint{
+	Path: "jujuusers/metrics",
+
+	Get: access.ClusterCATrustedEndpoint(cmdJujuUsersMetricsGet, true),
+}
+
+// /1.0/jujuusers/events endpoint.
+var jujuusersEventsCmd = rest.Endpoint{
+	Path: "jujuusers/events",
+
+	Get: access.ClusterCATrustedEndpoint(cmdJujuUsersEventsGet, true),
+}
+
+// /1.0/jujuusers/rotate endpoint.
+var jujuusersRotateCmd = rest.Endpoint{
+	Path: "jujuusers/rotate",
+
+	Post: access.ClusterCATrustedEndpoint(rateLimited(writeLimiter, cmdJujuUsersRotatePost), true),
+}
+
+// /1.0/jujuusers/maintain endpoint.
+var jujuusersMaintainCmd = rest.Endpoint{
+	Path: "jujuusers/maintain",
+
+	Post: access.ClusterCATrustedEndpoint(rateLimited(writeLimiter, cmdJujuUsersMaintainPost), true),
 }
 
 // /1.0/jujuusers/<name> endpoint.
+// The fixed jujuusers/<name> endpoints above shadow it, their names can't be used as usernames, see
+// database.CheckJujuUserRouteName.
 var jujuuserCmd = rest.Endpoint{
 	Path: "jujuusers/{name}",
 
 	Get:    access.ClusterCATrustedEndpoint(cmdJujuUsersGet, true),
-	Delete: access.ClusterCATrustedEndpoint(cmdJujuUsersDelete, true),
+	Patch:  access.ClusterCATrustedEndpoint(rateLimited(writeLimiter, cmdJujuUsersPatch), true),
+	Delete: access.ClusterCATrustedEndpoint(rateLimited(writeLimiter, cmdJujuUsersDelete), true),
+}
+
+// /1.0/jujuusers/<name>/detail endpoint.
+var jujuuserDetailCmd = rest.Endpoint{
+	Path: "jujuusers/{name}/detail",
+
+	Get: access.ClusterCATrustedEndpoint(cmdJujuUserDetailGet, true),
+}
+
+// writeLimiter returns the limiter applied to the juju user write endpoints, reloading its setting from the
+// cluster config every jujuUserWriteReloadInterval.
+func writeLimiter(s *state.State) *rateLimiter {
+	loaded := jujuUserWriteLoaded.Load()
+	if time.Since(time.Unix(0, loaded)) >= jujuUserWriteReloadInterval && jujuUserWriteLoaded.CompareAndSwap(loaded, time.Now().UnixNano()) {
+		reloadJujuUserWriteRate(s)
+	}
+
+	return jujuUserWriteLimiter.Load()
+}
+
+// requestContext returns the request context carrying the acting principal for audit attribution.
+func requestContext(r *http.Request) context.Context {
+	return database.WithActor(r.Context(), access.RequestActor(r))
 }
 
-func cmdJujuUsersGetAll(s *state.State, _ *http.Request) response.Response {
-	users, err := sunbeam.ListJujuUsers(s)
+// defaultJujuUserPageLimit is the page size used when paging with ?after but without ?limit.
+const defaultJujuUserPageLimit = 100
+
+// jujuUsersETagData returns a copy of users without the token age, which changes with every request.
+func jujuUsersETagData(users types.JujuUsers) types.JujuUsers {
+	data := make(types.JujuUsers, 0, len(users))
+	for _, user := range users {
+		user.TokenAgeSeconds = 0
+		data = append(data, user)
+	}
+
+	return data
+}
+
+func cmdJujuUsersGetAll(s *state.State, r *http.Request) response.Response {
+	sort := r.URL.Query().Get("sort")
+	order := r.URL.Query().Get("order")
+
+	// A spreadsheet friendly export of all users is requested with ?format=csv.
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "csv":
+		if len(r.URL.Query()) > 1 {
+			return response.BadRequest(fmt.Errorf("Juju users exported as CSV cannot be sorted, paged or searched"))
+		}
+
+		return response.ManualResponse(func(w http.ResponseWriter) error {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="jujuusers.csv"`)
+			w.WriteHeader(http.StatusOK)
+
+			return sunbeam.WriteJujuUsersCSV(requestContext(r), s, w)
+		})
+	default:
+		return response.BadRequest(fmt.Errorf("Invalid juju users format %q", r.URL.Query().Get("format")))
+	}
+
+	// Very large tables are streamed as a bare JSON array with ?stream, rather than rendered at once.
+	if shared.IsTrue(r.URL.Query().Get("stream")) {
+		if len(r.URL.Query()) > 1 {
+			return response.BadRequest(fmt.Errorf("Streamed juju users cannot be sorted, paged or searched"))
+		}
+
+		return response.ManualResponse(func(w http.ResponseWriter) error {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+
+			return sunbeam.WriteJujuUsersJSON(requestContext(r), s, w)
+		})
+	}
+
+	// A known subset of users is requested with repeated ?username and follows the username order.
+	if r.URL.Query().Has("username") {
+		if sort != "" || order != "" || r.URL.Query().Has("after") || r.URL.Query().Has("limit") || r.URL.Query().Has("display-name") {
+			return response.BadRequest(fmt.Errorf("Juju users fetched by username cannot be sorted, paged or searched"))
+		}
+
+		users, err := sunbeam.ListJujuUsersByName(s, r.URL.Query()["username"])
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return etagResponse(r, users, jujuUsersETagData(users))
+	}
+
+	// Searching by display name is requested with ?display-name and follows the username order.
+	if r.URL.Query().Has("display-name") {
+		if sort != "" || order != "" || r.URL.Query().Has("after") || r.URL.Query().Has("limit") {
+			return response.BadRequest(fmt.Errorf("Juju user searches cannot be sorted or paged"))
+		}
+
+		users, err := sunbeam.SearchJujuUsers(s, r.URL.Query().Get("display-name"))
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return etagResponse(r, users, jujuUsersETagData(users))
+	}
+
+	// Paging is requested with ?after and ?limit and always follows the username order.
+	if r.URL.Query().Has("after") || r.URL.Query().Has("limit") {
+		if (sort != "" && sort != "username") || (order != "" && order != "asc") {
+			return response.BadRequest(fmt.Errorf("Paged juju users can only be sorted by ascending username"))
+		}
+
+		limit := defaultJujuUserPageLimit
+		if r.URL.Query().Has("limit") {
+			var err error
+			limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+			if err != nil || limit <= 0 {
+				return response.BadRequest(fmt.Errorf("Invalid juju user page limit %q", r.URL.Query().Get("limit")))
+			}
+		}
+
+		page, err := sunbeam.ListJujuUsersPage(s, r.URL.Query().Get("after"), limit)
+		if err != nil {
+			return response.SmartError(err)
+		}
+
+		return &gzipResponse{r: r, resp: etagResponse(r, page, types.JujuUserPage{Users: jujuUsersETagData(page.Users), Next: page.Next})}
+	}
+
+	// Listings are always read linearizably, a valid consistency is accepted for compatibility.
+	_, err := sunbeam.ParseConsistency(r.URL.Query().Get("consistency"))
 	if err != nil {
-		return response.InternalError(err)
+		return response.SmartError(err)
 	}
 
-	return response.SyncResponse(true, users)
+	users, err := sunbeam.ListJujuUsers(s, sort, order)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	// Full listings can be large on clusters with many juju users.
+	return &gzipResponse{r: r, resp: etagResponse(r, users, jujuUsersETagData(users))}
+}
+
+// defaultJujuUserEventsLimit is the number of events returned when ?limit is not given.
+const defaultJujuUserEventsLimit = 1000
+
+func cmdJujuUsersEventsGet(s *state.State, r *http.Request) response.Response {
+	var since int64
+	if r.URL.Query().Has("since") {
+		var err error
+		since, err = strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		if err != nil || since < 0 {
+			return response.BadRequest(fmt.Errorf("Invalid juju user event sequence %q", r.URL.Query().Get("since")))
+		}
+	}
+
+	limit := defaultJujuUserEventsLimit
+	if r.URL.Query().Has("limit") {
+		var err error
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			return response.BadRequest(fmt.Errorf("Invalid juju user event limit %q", r.URL.Query().Get("limit")))
+		}
+	}
+
+	events, err := sunbeam.ListJujuUserEvents(s, since, limit)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, events)
+}
+
+func cmdJujuUsersStatsGet(s *state.State, r *http.Request) response.Response {
+	consistency, err := sunbeam.ParseConsistency(r.URL.Query().Get("consistency"))
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	stats, err := sunbeam.GetJujuUserStats(s, consistency)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, stats)
+}
+
+func cmdJujuUsersMetricsGet(_ *state.State, _ *http.Request) response.Response {
+	return response.ManualResponse(func(w http.ResponseWriter) error {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+
+		return sunbeam.WriteJujuUserMetrics(w)
+	})
 }
 
 func cmdJujuUsersGet(s *state.State, r *http.Request) response.Response {
-	var name string
 	name, err := url.PathUnescape(mux.Vars(r)["name"])
 	if err != nil {
-		return response.InternalError(err)
+		return response.BadRequest(err)
 	}
-	jujuUser, err := sunbeam.GetJujuUser(s, name)
+
+	jujuUser, err := sunbeam.GetJujuUser(s, name, shared.IsTrue(r.URL.Query().Get("suggest")))
 	if err != nil {
-		if err, ok := err.(api.StatusError); ok {
-			if err.Status() == http.StatusNotFound {
-				return response.NotFound(err)
-			}
-		}
-		return response.InternalError(err)
+		return response.SmartError(err)
 	}
 
 	return response.SyncResponse(true, jujuUser)
 }
 
+func cmdJujuUserDetailGet(s *state.State, r *http.Request) response.Response {
+	name, err := url.PathUnescape(mux.Vars(r)["name"])
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	detail, err := sunbeam.GetJujuUserDetail(s, name)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, detail)
+}
+
 func cmdJujuUsersPost(s *state.State, r *http.Request) response.Response {
 	var req types.JujuUser
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		return response.InternalError(err)
+		return response.BadRequest(err)
 	}
 
-	err = sunbeam.AddJujuUser(s, req.Username, req.Token)
+	err = sunbeam.AddJujuUser(requestContext(r), s, req.Username, req.Token, req.DisplayName)
 	if err != nil {
-		return response.InternalError(err)
+		return response.SmartError(err)
 	}
 
 	return response.EmptySyncResponse
 }
 
-func cmdJujuUsersDelete(s *state.State, r *http.Request) response.Response {
+func cmdJujuUsersBatchPost(s *state.State, r *http.Request) response.Response {
+	var req types.JujuUsers
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	results, err := sunbeam.AddJujuUsers(requestContext(r), s, req)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, results)
+}
+
+func cmdJujuUsersPatch(s *state.State, r *http.Request) response.Response {
 	name, err := url.PathUnescape(mux.Vars(r)["name"])
+	if err != nil {
+		return response.BadRequest(err)
+	}
+
+	var req types.JujuUserPatch
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		return response.BadRequest(err)
+	}
+
+	if req.Username == nil && req.Token == nil && req.DisplayName == nil {
+		return response.BadRequest(fmt.Errorf("No juju user fields to update"))
+	}
+
+	err = sunbeam.PatchJujuUser(requestContext(r), s, name, req)
 	if err != nil {
 		return response.SmartError(err)
 	}
-	err = sunbeam.DeleteJujuUser(s, name)
+
+	return response.EmptySyncResponse
+}
+
+func cmdJujuUsersDelete(s *state.State, r *http.Request) response.Response {
+	name, err := url.PathUnescape(mux.Vars(r)["name"])
 	if err != nil {
-		return response.InternalError(err)
+		return response.BadRequest(err)
+	}
+	err = sunbeam.DeleteJujuUser(requestContext(r), s, name, shared.IsTrue(r.URL.Query().Get("force")))
+	if err != nil {
+		return response.SmartError(err)
 	}
 
 	return response.EmptySyncResponse
 }
+
+func cmdJujuUsersMaintainPost(s *state.State, r *http.Request) response.Response {
+	report, err := sunbeam.MaintainJujuUsers(requestContext(r), s)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, report)
+}
+
+func cmdJujuUsersRotatePost(s *state.State, r *http.Request) response.Response {
+	rotated, err := sunbeam.RotateJujuUserTokens(requestContext(r), s)
+	if err != nil {
+		return response.SmartError(err)
+	}
+
+	return response.SyncResponse(true, types.JujuUserRotation{Rotated: rotated})
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/canonical/lxd/lxd/response"
+	"github.com/canonical/lxd/shared/logger"
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/sunbeam"
+)
+
+// rateLimiter is a token bucket allowing rate requests per second with bursts of up to burst requests.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// newRateLimiter returns a rateLimiter, a rate of zero or less disables limiting.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// Allow consumes a token and reports whether the request may proceed.
+func (l *rateLimiter) Allow() bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+
+	return true
+}
+
+// jujuUserWriteReloadInterval is how often the juju user write limit is reloaded from the cluster config, so
+// that changes made through other members are picked up too.
+const jujuUserWriteReloadInterval = 30 * time.Second
+
+// rateSetting is the rate and burst of a rateLimiter.
+type rateSetting struct {
+	rate  float64
+	burst int
+}
+
+// jujuUserWriteLimiter throttles the endpoints modifying juju users. It is replaced whenever its setting changes.
+var jujuUserWriteLimiter atomic.Pointer[rateLimiter]
+
+// jujuUserWriteDefault is the limit set with SetJujuUserWriteRate, applied unless the cluster config sets one.
+var jujuUserWriteDefault atomic.Pointer[rateSetting]
+
+// jujuUserWriteLoaded is when the juju user write limit was last loaded from the cluster config, in Unix nanoseconds.
+var jujuUserWriteLoaded atomic.Int64
+
+func init() {
+	SetJujuUserWriteRate(0, 1)
+
+	for _, key := range []string{sunbeam.JujuUserWriteRate, sunbeam.JujuUserWriteBurst} {
+		sunbeam.WatchConfig(key, func(s *state.State, _ string, _ string) {
+			reloadJujuUserWriteRate(s)
+		})
+	}
+}
+
+// SetJujuUserWriteRate limits juju user writes to rate requests per second with the given burst.
+// A rate of zero disables the limit. The jujuuser.write-rate and jujuuser.write-burst config keys take
+// precedence once set, and are reloaded when changed.
+func SetJujuUserWriteRate(rate float64, burst int) {
+	jujuUserWriteDefault.Store(&rateSetting{rate: rate, burst: burst})
+	setJujuUserWriteRate(rate, burst)
+}
+
+// setJujuUserWriteRate replaces the juju user write limiter by one with the given rate and burst, unless it
+// already has them so that a reload leaves the tokens of the current one untouched.
+func setJujuUserWriteRate(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	current := jujuUserWriteLimiter.Load()
+	if current != nil && current.rate == rate && current.burst == float64(burst) {
+		return
+	}
+
+	jujuUserWriteLimiter.Store(newRateLimiter(rate, burst))
+}
+
+// reloadJujuUserWriteRate applies the juju user write limit of the cluster config. The current limit is kept if
+// the config can't be read.
+func reloadJujuUserWriteRate(s *state.State) {
+	jujuUserWriteLoaded.Store(time.Now().UnixNano())
+
+	defaults := jujuUserWriteDefault.Load()
+	rate, burst, err := sunbeam.GetJujuUserWriteRate(s, defaults.rate, defaults.burst)
+	if err != nil {
+		logger.Warn("Failed to load the juju user write limit, keeping the current one", logger.Ctx{"err": err})
+		return
+	}
+
+	setJujuUserWriteRate(rate, burst)
+}
+
+// rateLimited wraps handler so that requests exceeding the limiter get a 429 response.
+func rateLimited(limiter func(s *state.State) *rateLimiter, handler func(s *state.State, r *http.Request) response.Response) func(s *state.State, r *http.Request) response.Response {
+	return func(s *state.State, r *http.Request) response.Response {
+		if !limiter(s).Allow() {
+			return response.ErrorResponse(http.StatusTooManyRequests, fmt.Sprintf("Too many requests to %q, retry later", r.URL.Path))
+		}
+
+		return handler(s, r)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/canonical/lxd/lxd/response"
+	"github.com/canonical/microcluster/state"
+)
+
+// fakeClock is a clock only moving forward when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// statusOf returns the HTTP status of resp.
+func statusOf(t *testing.T, resp response.Response) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	err := resp.Render(recorder)
+	if err != nil {
+		t.Fatalf("Failed to render response: %v", err)
+	}
+
+	return recorder.Code
+}
+
+func TestRateLimited(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := newRateLimiter(1, 2)
+	limiter.now = clock.Now
+
+	handler := rateLimited(func(*state.State) *rateLimiter { return limiter }, func(*state.State, *http.Request) response.Response {
+		return response.EmptySyncResponse
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/1.0/jujuusers", nil)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		got := statusOf(t, handler(nil, request))
+		if got != want {
+			t.Fatalf("Request %d: expected status %d, got %d", i, want, got)
+		}
+	}
+
+	clock.now = clock.now.Add(time.Second)
+
+	got := statusOf(t, handler(nil, request))
+	if got != http.StatusOK {
+		t.Fatalf("Expected the limit to recover after a second, got status %d", got)
+	}
+
+	got = statusOf(t, handler(nil, request))
+	if got != http.StatusTooManyRequests {
+		t.Fatalf("Expected a single request to be allowed after a second, got status %d", got)
+	}
+}
+
+func TestSetJujuUserWriteRate(t *testing.T) {
+	defer SetJujuUserWriteRate(0, 1)
+
+	SetJujuUserWriteRate(5, 10)
+	limiter := jujuUserWriteLimiter.Load()
+
+	setJujuUserWriteRate(5, 10)
+	if jujuUserWriteLimiter.Load() != limiter {
+		t.Fatalf("Expected an unchanged setting to keep the current limiter")
+	}
+
+	setJujuUserWriteRate(1, 10)
+	changed := jujuUserWriteLimiter.Load()
+	if changed == limiter || changed.rate != 1 || changed.burst != 10 {
+		t.Fatalf("Expected a limiter with the new rate, got rate %v and burst %v", changed.rate, changed.burst)
+	}
+}
@@ -23,7 +23,14 @@ var Servers = []rest.Server{
 					terraformLockCmd,
 					terraformUnlockCmd,
 					jujuusersCmd,
+					jujuusersBatchCmd,
+					jujuusersEventsCmd,
+					jujuusersMaintainCmd,
+					jujuusersMetricsCmd,
+					jujuusersRotateCmd,
+					jujuusersStatsCmd,
 					jujuuserCmd,
+					jujuuserDetailCmd,
 					configCmd,
 					manifestsCmd,
 					manifestCmd,
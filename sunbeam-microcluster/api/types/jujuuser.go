@@ -1,11 +1,87 @@
 // Package types provides shared types and structs.
 package types
 
+import (
+	"time"
+)
+
 // JujuUsers is list of JujuUser struct
 type JujuUsers []JujuUser
 
 // JujuUser structure to hold juju user registration tokens
 type JujuUser struct {
+	Username    string `json:"username" yaml:"username"`
+	Token       string `json:"token" yaml:"token"`
+	DisplayName string `json:"display-name,omitempty" yaml:"display-name,omitempty"`
+
+	// TokenFingerprint identifies the token without exposing it, it is computed by the server and ignored on input.
+	TokenFingerprint string `json:"token-fingerprint,omitempty" yaml:"token-fingerprint,omitempty"`
+
+	// TokenAgeSeconds is the time since the user was last updated, it is computed and never stored.
+	TokenAgeSeconds int64 `json:"token-age-seconds" yaml:"token-age-seconds"`
+
+	// TokenUnavailable is set when the server can't decrypt the token because its encryption key is missing.
+	TokenUnavailable bool `json:"token-unavailable,omitempty" yaml:"token-unavailable,omitempty"`
+}
+
+// JujuUserDetail holds a juju user along with its roles, labels and the services of its node
+type JujuUserDetail struct {
+	JujuUser `yaml:",inline"`
+
+	Roles    []string          `json:"roles" yaml:"roles"`
+	Labels   map[string]string `json:"labels" yaml:"labels"`
+	Services []string          `json:"services" yaml:"services"`
+}
+
+// JujuUserPage holds a page of juju users, Next is the cursor of the following page and empty on the last one
+type JujuUserPage struct {
+	Users JujuUsers `json:"users" yaml:"users"`
+	Next  string    `json:"next,omitempty" yaml:"next,omitempty"`
+}
+
+// JujuUserRotation holds the result of a juju user token rotation
+type JujuUserRotation struct {
+	Rotated int `json:"rotated" yaml:"rotated"`
+}
+
+// JujuUserMaintenance holds the steps completed by a juju user maintenance, in order
+type JujuUserMaintenance struct {
+	Steps []JujuUserMaintenanceStep `json:"steps" yaml:"steps"`
+}
+
+// JujuUserMaintenanceStep holds the name of a juju user maintenance step and the number of rows it changed
+type JujuUserMaintenanceStep struct {
+	Name    string `json:"name" yaml:"name"`
+	Changed int64  `json:"changed" yaml:"changed"`
+}
+
+// JujuUserPatch holds the juju user fields to update, nil fields are left unchanged
+type JujuUserPatch struct {
+	Username    *string `json:"username,omitempty" yaml:"username,omitempty"`
+	Token       *string `json:"token,omitempty" yaml:"token,omitempty"`
+	DisplayName *string `json:"display-name,omitempty" yaml:"display-name,omitempty"`
+}
+
+// JujuUserBatchResult holds the outcome of adding one juju user of a batch, Error is empty on success
+type JujuUserBatchResult struct {
 	Username string `json:"username" yaml:"username"`
-	Token    string `json:"token" yaml:"token"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// JujuUserEvent is a juju user change, Sequence increases monotonically with every change
+type JujuUserEvent struct {
+	Sequence int64     `json:"sequence" yaml:"sequence"`
+	Username string    `json:"username" yaml:"username"`
+	Action   string    `json:"action" yaml:"action"`
+	Time     time.Time `json:"time" yaml:"time"`
+}
+
+// JujuUserStats summarizes the stored juju users, the update times are unset when there are none
+type JujuUserStats struct {
+	Total           int64      `json:"total" yaml:"total"`
+	EmptyTokens     int64      `json:"empty-tokens" yaml:"empty-tokens"`
+	OldestUpdatedAt *time.Time `json:"oldest-updated-at,omitempty" yaml:"oldest-updated-at,omitempty"`
+	NewestUpdatedAt *time.Time `json:"newest-updated-at,omitempty" yaml:"newest-updated-at,omitempty"`
+	CreatedTotal    int64      `json:"created-total" yaml:"created-total"`
+	DeletedTotal    int64      `json:"deleted-total" yaml:"deleted-total"`
 }
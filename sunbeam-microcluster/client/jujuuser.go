@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+	microCli "github.com/canonical/microcluster/client"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/api/types"
+)
+
+// JujuUserImportRowError describes a row of an import file that could not be parsed.
+// Row is 1-based, counting the CSV header line or the JSON list element.
+type JujuUserImportRowError struct {
+	Row   int
+	Error string
+}
+
+// JujuUserImportResult holds the outcome of ImportFromFile.
+type JujuUserImportResult struct {
+	// Results has the outcome of every parsed user sent to the cluster.
+	Results []types.JujuUserBatchResult
+	// Malformed has the rows that could not be parsed and were not sent.
+	Malformed []JujuUserImportRowError
+}
+
+// JujuUsersBatchCreate adds the juju users in a single request and returns the outcome of every one of them.
+// The batch API is experimental, the daemon answers with a not implemented error unless it is enabled.
+func JujuUsersBatchCreate(ctx context.Context, c *microCli.Client, users types.JujuUsers) ([]types.JujuUserBatchResult, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	results := []types.JujuUserBatchResult{}
+	err := c.Query(queryCtx, "POST", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", "batch"), users, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ImportFromFile adds the juju users listed in the file at path.
+// Files with a .json extension hold a list of juju user objects, files with a .csv extension hold
+// username,token rows with an optional header line. Malformed rows are reported but do not abort the import.
+// It relies on JujuUsersBatchCreate, so the experimental batch API must be enabled.
+func ImportFromFile(ctx context.Context, c *microCli.Client, path string) (*JujuUserImportResult, error) {
+	users, malformed, err := ParseJujuUsersFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &JujuUserImportResult{Results: []types.JujuUserBatchResult{}, Malformed: malformed}
+	if len(users) == 0 {
+		return result, nil
+	}
+
+	result.Results, err = JujuUsersBatchCreate(ctx, c, users)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ParseJujuUsersFile reads the juju users from a JSON or CSV file, detected by its extension.
+// It returns the well-formed users along with the rows that could not be parsed.
+func ParseJujuUsersFile(path string) (types.JujuUsers, []JujuUserImportRowError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open juju user import file: %w", err)
+	}
+
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJujuUsersJSON(f)
+	case ".csv":
+		return parseJujuUsersCSV(f)
+	default:
+		return nil, nil, fmt.Errorf("Unsupported juju user import file %q, expected a .json or .csv file", path)
+	}
+}
+
+// parseJujuUsersJSON parses a list of juju user objects, decoding each element on its own.
+func parseJujuUsersJSON(r io.Reader) (types.JujuUsers, []JujuUserImportRowError, error) {
+	rows := []json.RawMessage{}
+	err := json.NewDecoder(r).Decode(&rows)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse juju user import file: %w", err)
+	}
+
+	users := types.JujuUsers{}
+	malformed := []JujuUserImportRowError{}
+
+	for i, row := range rows {
+		user := types.JujuUser{}
+		err := json.Unmarshal(row, &user)
+		if err == nil {
+			err = validateImportedJujuUser(user)
+		}
+
+		if err != nil {
+			malformed = append(malformed, JujuUserImportRowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	return users, malformed, nil
+}
+
+// parseJujuUsersCSV parses username,token rows, skipping a leading header line.
+func parseJujuUsersCSV(r io.Reader) (types.JujuUsers, []JujuUserImportRowError, error) {
+	reader := csv.NewReader(r)
+	// Field counts are checked per row so a short row is reported instead of failing the whole file.
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	users := types.JujuUsers{}
+	malformed := []JujuUserImportRowError{}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				malformed = append(malformed, JujuUserImportRowError{Row: row, Error: parseErr.Err.Error()})
+				continue
+			}
+
+			return nil, nil, fmt.Errorf("Failed to read juju user import file: %w", err)
+		}
+
+		if row == 1 && len(record) > 0 && strings.EqualFold(record[0], "username") {
+			continue
+		}
+
+		if len(record) != 2 {
+			malformed = append(malformed, JujuUserImportRowError{Row: row, Error: fmt.Sprintf("Expected 2 fields, got %d", len(record))})
+			continue
+		}
+
+		user := types.JujuUser{Username: record[0], Token: record[1]}
+		err = validateImportedJujuUser(user)
+		if err != nil {
+			malformed = append(malformed, JujuUserImportRowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	return users, malformed, nil
+}
+
+// validateImportedJujuUser checks the fields required to add a juju user are set.
+func validateImportedJujuUser(user types.JujuUser) error {
+	if user.Username == "" {
+		return fmt.Errorf("Missing juju user username")
+	}
+
+	if user.Token == "" {
+		return fmt.Errorf("Missing token for juju user %q", user.Username)
+	}
+
+	return nil
+}
+
+// JujuUsersList returns all the juju users.
+func JujuUsersList(ctx context.Context, c *microCli.Client) (types.JujuUsers, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	users := types.JujuUsers{}
+	err := c.Query(queryCtx, "GET", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers"), nil, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// JujuUsersStats returns a summary of the stored juju users.
+func JujuUsersStats(ctx context.Context, c *microCli.Client) (*types.JujuUserStats, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	stats := &types.JujuUserStats{}
+	err := c.Query(queryCtx, "GET", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", "stats"), nil, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// JujuUserGet returns the juju user with the given name.
+func JujuUserGet(ctx context.Context, c *microCli.Client, name string) (*types.JujuUser, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	user := &types.JujuUser{}
+	err := c.Query(queryCtx, "GET", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", name), nil, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// JujuUserDetail returns the juju user with its roles, labels and services.
+func JujuUserDetail(ctx context.Context, c *microCli.Client, name string) (*types.JujuUserDetail, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	detail := &types.JujuUserDetail{}
+	err := c.Query(queryCtx, "GET", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", name, "detail"), nil, detail)
+	if err != nil {
+		return nil, err
+	}
+
+	return detail, nil
+}
+
+// JujuUserAdd adds a juju user.
+func JujuUserAdd(ctx context.Context, c *microCli.Client, user types.JujuUser) error {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	return c.Query(queryCtx, "POST", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers"), user, nil)
+}
+
+// JujuUserPatch updates the fields of the juju user set in patch.
+func JujuUserPatch(ctx context.Context, c *microCli.Client, name string, patch types.JujuUserPatch) error {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	return c.Query(queryCtx, "PATCH", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", name), patch, nil)
+}
+
+// JujuUserDelete deletes a juju user.
+func JujuUserDelete(ctx context.Context, c *microCli.Client, name string) error {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	return c.Query(queryCtx, "DELETE", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", name), nil, nil)
+}
+
+// JujuUsersRotate replaces the tokens of all juju users and returns the number of rotated users.
+func JujuUsersRotate(ctx context.Context, c *microCli.Client) (int, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	rotation := types.JujuUserRotation{}
+	err := c.Query(queryCtx, "POST", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", "rotate"), nil, &rotation)
+	if err != nil {
+		return 0, err
+	}
+
+	return rotation.Rotated, nil
+}
+
+// JujuUsersMaintain runs the security maintenance of the juju users and returns the completed steps.
+func JujuUsersMaintain(ctx context.Context, c *microCli.Client) (*types.JujuUserMaintenance, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Second*300)
+	defer cancel()
+
+	report := &types.JujuUserMaintenance{}
+	err := c.Query(queryCtx, "POST", types.ExtendedPathPrefix, api.NewURL().Path("jujuusers", "maintain"), nil, report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
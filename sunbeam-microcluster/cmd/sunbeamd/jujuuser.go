@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+
+	"github.com/canonical/lxd/shared/api"
+	microCli "github.com/canonical/microcluster/client"
+	"github.com/canonical/microcluster/microcluster"
+	"github.com/spf13/cobra"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/api/types"
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/client"
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// jujuUserClient is the subset of the client package used by the jujuuser commands.
+type jujuUserClient interface {
+	List(ctx context.Context) (types.JujuUsers, error)
+	Get(ctx context.Context, name string) (*types.JujuUser, error)
+	Add(ctx context.Context, user types.JujuUser) error
+	Patch(ctx context.Context, name string, patch types.JujuUserPatch) error
+	Delete(ctx context.Context, name string) error
+	RotateAll(ctx context.Context) (int, error)
+}
+
+// localJujuUserClient sends the jujuuser commands to the local daemon.
+type localJujuUserClient struct {
+	c *microCli.Client
+}
+
+func (l localJujuUserClient) List(ctx context.Context) (types.JujuUsers, error) {
+	return client.JujuUsersList(ctx, l.c)
+}
+
+func (l localJujuUserClient) Get(ctx context.Context, name string) (*types.JujuUser, error) {
+	return client.JujuUserGet(ctx, l.c, name)
+}
+
+func (l localJujuUserClient) Add(ctx context.Context, user types.JujuUser) error {
+	return client.JujuUserAdd(ctx, l.c, user)
+}
+
+func (l localJujuUserClient) Patch(ctx context.Context, name string, patch types.JujuUserPatch) error {
+	return client.JujuUserPatch(ctx, l.c, name, patch)
+}
+
+func (l localJujuUserClient) Delete(ctx context.Context, name string) error {
+	return client.JujuUserDelete(ctx, l.c, name)
+}
+
+func (l localJujuUserClient) RotateAll(ctx context.Context) (int, error) {
+	return client.JujuUsersRotate(ctx, l.c)
+}
+
+type cmdJujuUser struct {
+	daemon *cmdDaemon
+
+	// newClient returns the client to use, tests replace it with a fake.
+	newClient func() (jujuUserClient, error)
+
+	flagShowTokens  bool
+	flagDisplayName string
+}
+
+func (c *cmdJujuUser) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jujuuser",
+		Short: "Manage juju users",
+	}
+
+	if c.newClient == nil {
+		c.newClient = c.localClient
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List juju users",
+		Args:  cobra.NoArgs,
+		RunE:  c.runList,
+	}
+
+	list.Flags().BoolVar(&c.flagShowTokens, "show-tokens", false, "Show the juju user tokens")
+
+	add := &cobra.Command{
+		Use:   "add <name> <token>",
+		Short: "Add a juju user",
+		Args:  cobra.ExactArgs(2),
+		RunE:  c.runAdd,
+	}
+
+	add.Flags().StringVar(&c.flagDisplayName, "display-name", "", "Human friendly name of the juju user")
+
+	remove := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a juju user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  c.runRemove,
+	}
+
+	rotate := &cobra.Command{
+		Use:   "rotate-token [<name>]",
+		Short: "Replace the token of a juju user, or of all juju users when no name is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  c.runRotateToken,
+	}
+
+	selfTest := &cobra.Command{
+		Use:   "self-test",
+		Short: "Check that juju users can be created, read, updated and deleted",
+		Long:  "Round-trip the temporary juju user " + database.SelfTestJujuUsername + " through the daemon, it is removed once done, even on failure.",
+		Args:  cobra.NoArgs,
+		RunE:  c.runSelfTest,
+	}
+
+	cmd.AddCommand(list, add, remove, rotate, selfTest)
+
+	return cmd
+}
+
+// localClient returns a client of the daemon running with the configured state directory.
+func (c *cmdJujuUser) localClient() (jujuUserClient, error) {
+	m, err := microcluster.App(microcluster.Args{StateDir: c.daemon.flagStateDir, Verbose: c.daemon.global.flagLogVerbose, Debug: c.daemon.global.flagLogDebug})
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := m.LocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return localJujuUserClient{c: cli}, nil
+}
+
+func (c *cmdJujuUser) runList(cmd *cobra.Command, _ []string) error {
+	cli, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	users, err := cli.List(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	return printJujuUsers(cmd.OutOrStdout(), users, c.flagShowTokens)
+}
+
+// printJujuUsers writes users as a table, tokens are shown by their fingerprint unless showTokens is set.
+func printJujuUsers(w io.Writer, users types.JujuUsers, showTokens bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "USERNAME\tDISPLAY NAME\tTOKEN")
+	for _, user := range users {
+		token := "<redacted>"
+		if user.TokenFingerprint != "" {
+			token = "fingerprint:" + user.TokenFingerprint
+		}
+
+		if showTokens {
+			token = user.Token
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", user.Username, user.DisplayName, token)
+	}
+
+	return tw.Flush()
+}
+
+func (c *cmdJujuUser) runAdd(cmd *cobra.Command, args []string) error {
+	cli, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.Add(cmd.Context(), types.JujuUser{Username: args[0], Token: args[1], DisplayName: c.flagDisplayName})
+}
+
+func (c *cmdJujuUser) runRemove(cmd *cobra.Command, args []string) error {
+	cli, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.Delete(cmd.Context(), args[0])
+}
+
+func (c *cmdJujuUser) runRotateToken(cmd *cobra.Command, args []string) error {
+	cli, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		rotated, err := cli.RotateAll(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Rotated the tokens of %d juju users\n", rotated)
+
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	return cli.Patch(cmd.Context(), args[0], types.JujuUserPatch{Token: &token})
+}
+
+// generateToken returns a random juju user token.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate token: %w", err)
+	}
+
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+// selfTestStep is a step of the self-test, run reports why it failed.
+type selfTestStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (c *cmdJujuUser) runSelfTest(cmd *cobra.Command, _ []string) error {
+	cli, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	return runJujuUserSelfTest(cmd.Context(), cli, cmd.OutOrStdout())
+}
+
+// runJujuUserSelfTest round-trips the self-test juju user through cli and reports every step to w.
+// Steps stop at the first failure, the user is deleted in any case.
+func runJujuUserSelfTest(ctx context.Context, cli jujuUserClient, w io.Writer) error {
+	name := database.SelfTestJujuUsername
+
+	// A self-test that was interrupted may have left its user behind.
+	err := cli.Delete(ctx, name)
+	if err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+		return fmt.Errorf("Failed to remove juju user %q left by a previous self-test: %w", name, err)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	// checkToken reads the user back and checks that it holds want.
+	checkToken := func(ctx context.Context, want string) error {
+		user, err := cli.Get(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if user.Token != want {
+			return fmt.Errorf("Juju user %q holds an unexpected token", name)
+		}
+
+		return nil
+	}
+
+	created := false
+	deleted := false
+	steps := []selfTestStep{
+		{name: "create", run: func(ctx context.Context) error {
+			err := cli.Add(ctx, types.JujuUser{Username: name, Token: token})
+			if err == nil {
+				created = true
+			}
+
+			return err
+		}},
+		{name: "read", run: func(ctx context.Context) error {
+			return checkToken(ctx, token)
+		}},
+		{name: "update", run: func(ctx context.Context) error {
+			return cli.Patch(ctx, name, types.JujuUserPatch{Token: &newToken})
+		}},
+		{name: "verify", run: func(ctx context.Context) error {
+			return checkToken(ctx, newToken)
+		}},
+		{name: "delete", run: func(ctx context.Context) error {
+			err := cli.Delete(ctx, name)
+			if err == nil {
+				deleted = true
+			}
+
+			return err
+		}},
+	}
+
+	var failed error
+	for _, step := range steps {
+		if failed != nil {
+			fmt.Fprintf(w, "SKIP  %s\n", step.name)
+			continue
+		}
+
+		err := step.run(ctx)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", step.name, err)
+			failed = fmt.Errorf("Self-test failed at step %q: %w", step.name, err)
+			continue
+		}
+
+		fmt.Fprintf(w, "PASS  %s\n", step.name)
+	}
+
+	if created && !deleted {
+		err := cli.Delete(ctx, name)
+		if err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+			fmt.Fprintf(w, "FAIL  cleanup: %v\n", err)
+			return errors.Join(failed, fmt.Errorf("Failed to remove self-test juju user %q: %w", name, err))
+		}
+
+		fmt.Fprintf(w, "PASS  cleanup\n")
+	}
+
+	return failed
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/canonical/lxd/shared/api"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/api/types"
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// fakeJujuUserClient keeps juju users in memory, failing the calls of the operations listed in fail.
+type fakeJujuUserClient struct {
+	users map[string]types.JujuUser
+	fail  map[string]error
+	calls []string
+}
+
+func newFakeJujuUserClient(users ...types.JujuUser) *fakeJujuUserClient {
+	f := &fakeJujuUserClient{users: map[string]types.JujuUser{}, fail: map[string]error{}}
+	for _, user := range users {
+		f.users[user.Username] = user
+	}
+
+	return f
+}
+
+// call records a call of operation and returns the error it is set to fail with.
+func (f *fakeJujuUserClient) call(operation string) error {
+	f.calls = append(f.calls, operation)
+
+	return f.fail[operation]
+}
+
+func (f *fakeJujuUserClient) List(_ context.Context) (types.JujuUsers, error) {
+	err := f.call("list")
+	if err != nil {
+		return nil, err
+	}
+
+	users := types.JujuUsers{}
+	for _, user := range f.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	return users, nil
+}
+
+func (f *fakeJujuUserClient) Get(_ context.Context, name string) (*types.JujuUser, error) {
+	err := f.call("get")
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := f.users[name]
+	if !ok {
+		return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser not found")
+	}
+
+	return &user, nil
+}
+
+func (f *fakeJujuUserClient) Add(_ context.Context, user types.JujuUser) error {
+	err := f.call("add")
+	if err != nil {
+		return err
+	}
+
+	_, ok := f.users[user.Username]
+	if ok {
+		return api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+	}
+
+	f.users[user.Username] = user
+
+	return nil
+}
+
+func (f *fakeJujuUserClient) Patch(_ context.Context, name string, patch types.JujuUserPatch) error {
+	err := f.call("patch")
+	if err != nil {
+		return err
+	}
+
+	user, ok := f.users[name]
+	if !ok {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser not found")
+	}
+
+	if patch.Token != nil {
+		user.Token = *patch.Token
+	}
+
+	f.users[name] = user
+
+	return nil
+}
+
+func (f *fakeJujuUserClient) Delete(_ context.Context, name string) error {
+	err := f.call("delete")
+	if err != nil {
+		return err
+	}
+
+	_, ok := f.users[name]
+	if !ok {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser not found")
+	}
+
+	delete(f.users, name)
+
+	return nil
+}
+
+func (f *fakeJujuUserClient) RotateAll(_ context.Context) (int, error) {
+	err := f.call("rotate")
+	if err != nil {
+		return 0, err
+	}
+
+	for name, user := range f.users {
+		user.Token = "rotated-" + name
+		f.users[name] = user
+	}
+
+	return len(f.users), nil
+}
+
+// runJujuUserCommand runs the jujuuser command with args against cli and returns what it printed.
+func runJujuUserCommand(t *testing.T, cli jujuUserClient, args ...string) (string, error) {
+	t.Helper()
+
+	c := &cmdJujuUser{newClient: func() (jujuUserClient, error) { return cli, nil }}
+	cmd := c.Command()
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+
+	return out.String(), err
+}
+
+func TestJujuUserSelfTest(t *testing.T) {
+	cli := newFakeJujuUserClient()
+
+	out, err := runJujuUserCommand(t, cli, "self-test")
+	if err != nil {
+		t.Fatalf("Expected the self-test to pass: %v\n%s", err, out)
+	}
+
+	for _, step := range []string{"create", "read", "update", "verify", "delete"} {
+		if !strings.Contains(out, "PASS  "+step+"\n") {
+			t.Errorf("Expected step %q to pass, got:\n%s", step, out)
+		}
+	}
+
+	if strings.Contains(out, "cleanup") {
+		t.Errorf("Expected no cleanup after a successful self-test, got:\n%s", out)
+	}
+
+	if len(cli.users) != 0 {
+		t.Errorf("Expected the self-test juju user to be removed, got %v", cli.users)
+	}
+}
+
+func TestJujuUserSelfTestCleansUpOnFailure(t *testing.T) {
+	cli := newFakeJujuUserClient()
+	cli.fail["patch"] = errors.New("update refused")
+
+	out, err := runJujuUserCommand(t, cli, "self-test")
+	if err == nil || !strings.Contains(err.Error(), `step "update"`) {
+		t.Fatalf("Expected the self-test to fail at the update, got %v", err)
+	}
+
+	for _, line := range []string{"PASS  create\n", "PASS  read\n", "FAIL  update: update refused\n", "SKIP  verify\n", "SKIP  delete\n", "PASS  cleanup\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in the output, got:\n%s", line, out)
+		}
+	}
+
+	_, ok := cli.users[database.SelfTestJujuUsername]
+	if ok {
+		t.Errorf("Expected the self-test juju user to be removed after the failure")
+	}
+}
+
+func TestJujuUserSelfTestRemovesLeftovers(t *testing.T) {
+	cli := newFakeJujuUserClient(types.JujuUser{Username: database.SelfTestJujuUsername, Token: "left-over"})
+
+	_, err := runJujuUserCommand(t, cli, "self-test")
+	if err != nil {
+		t.Fatalf("Expected the self-test to pass over a leftover user: %v", err)
+	}
+
+	if len(cli.users) != 0 {
+		t.Errorf("Expected the self-test juju user to be removed, got %v", cli.users)
+	}
+}
+
+func TestJujuUserList(t *testing.T) {
+	cli := newFakeJujuUserClient(
+		types.JujuUser{Username: "alice", Token: "secret-a", DisplayName: "Alice", TokenFingerprint: "abcd"},
+		types.JujuUser{Username: "bob", Token: "secret-b"},
+	)
+
+	out, err := runJujuUserCommand(t, cli, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out, "secret-") {
+		t.Errorf("Expected the tokens to be redacted, got:\n%s", out)
+	}
+
+	for _, want := range []string{"fingerprint:abcd", "<redacted>", "Alice"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the listing, got:\n%s", want, out)
+		}
+	}
+
+	out, err = runJujuUserCommand(t, cli, "list", "--show-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"secret-a", "secret-b"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the listing with --show-tokens, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestJujuUserAdd(t *testing.T) {
+	cli := newFakeJujuUserClient()
+
+	_, err := runJujuUserCommand(t, cli, "add", "alice", "secret-a", "--display-name", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := types.JujuUser{Username: "alice", Token: "secret-a", DisplayName: "Alice"}
+	if cli.users["alice"] != want {
+		t.Errorf("Expected %+v to be added, got %+v", want, cli.users["alice"])
+	}
+
+	_, err = runJujuUserCommand(t, cli, "add", "alice", "secret-b")
+	if !api.StatusErrorCheck(err, http.StatusConflict) {
+		t.Errorf("Expected adding an existing user to fail with a conflict, got %v", err)
+	}
+
+	_, err = runJujuUserCommand(t, cli, "add", "alice")
+	if err == nil {
+		t.Errorf("Expected add without a token to fail")
+	}
+}
+
+func TestJujuUserRemove(t *testing.T) {
+	cli := newFakeJujuUserClient(types.JujuUser{Username: "alice", Token: "secret-a"})
+
+	_, err := runJujuUserCommand(t, cli, "remove", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cli.users) != 0 {
+		t.Errorf("Expected alice to be removed, got %v", cli.users)
+	}
+
+	_, err = runJujuUserCommand(t, cli, "remove", "alice")
+	if !api.StatusErrorCheck(err, http.StatusNotFound) {
+		t.Errorf("Expected removing a missing user to fail with not found, got %v", err)
+	}
+}
+
+func TestJujuUserRotateToken(t *testing.T) {
+	cli := newFakeJujuUserClient(
+		types.JujuUser{Username: "alice", Token: "secret-a"},
+		types.JujuUser{Username: "bob", Token: "secret-b"},
+	)
+
+	out, err := runJujuUserCommand(t, cli, "rotate-token", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.users["alice"].Token == "secret-a" || cli.users["alice"].Token == "" {
+		t.Errorf("Expected alice to get a new token, got %q", cli.users["alice"].Token)
+	}
+
+	if strings.Contains(out, cli.users["alice"].Token) {
+		t.Errorf("Expected the new token not to be printed, got:\n%s", out)
+	}
+
+	if cli.users["bob"].Token != "secret-b" {
+		t.Errorf("Expected bob to keep the same token, got %q", cli.users["bob"].Token)
+	}
+
+	out, err = runJujuUserCommand(t, cli, "rotate-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "Rotated the tokens of 2 juju users\n" {
+		t.Errorf("Unexpected output of a full rotation: %q", out)
+	}
+}
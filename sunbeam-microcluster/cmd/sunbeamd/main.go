@@ -3,8 +3,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/canonical/lxd/shared/logger"
@@ -46,6 +48,20 @@ type cmdDaemon struct {
 
 	flagStateDir    string
 	flagSocketGroup string
+
+	flagJujuUserWriteRate  float64
+	flagJujuUserWriteBurst int
+
+	flagJujuUserTokenKeyFile string
+
+	flagJujuUserMaxBatchSize int
+	flagJujuUserMaxUsers     int
+
+	flagJujuUserReservedUsernames []string
+
+	flagJujuUserSkipNoOpTokenUpdates bool
+
+	flagLogSensitiveFields []string
 }
 
 func (c *cmdDaemon) Command() *cobra.Command {
@@ -61,6 +77,26 @@ func (c *cmdDaemon) Command() *cobra.Command {
 }
 
 func (c *cmdDaemon) Run(_ *cobra.Command, _ []string) error {
+	api.SetJujuUserWriteRate(c.flagJujuUserWriteRate, c.flagJujuUserWriteBurst)
+	database.AddSensitiveLogFields(c.flagLogSensitiveFields...)
+	database.SetMaxJujuUserBatchSize(c.flagJujuUserMaxBatchSize)
+	database.SetMaxJujuUsers(c.flagJujuUserMaxUsers)
+	database.SetReservedJujuUsernames(c.flagJujuUserReservedUsernames...)
+	database.SetSkipNoOpTokenUpdates(c.flagJujuUserSkipNoOpTokenUpdates)
+
+	if c.flagJujuUserTokenKeyFile != "" {
+		key, err := os.ReadFile(c.flagJujuUserTokenKeyFile)
+		if err == nil {
+			err = database.SetTokenEncryptionKey(key)
+		}
+
+		// Keep serving what doesn't need the key rather than refusing to start.
+		if err != nil {
+			logger.Warn("JUJU USER TOKENS UNAVAILABLE: failed to load the token encryption key, running in degraded mode", logger.Ctx{"path": c.flagJujuUserTokenKeyFile, "err": err})
+			database.SetTokenKeyUnavailable()
+		}
+	}
+
 	m, err := microcluster.App(microcluster.Args{StateDir: c.flagStateDir, SocketGroup: c.flagSocketGroup, Verbose: c.global.flagLogVerbose, Debug: c.global.flagLogDebug, ExtensionServers: api.Servers})
 	if err != nil {
 		return err
@@ -69,31 +105,50 @@ func (c *cmdDaemon) Run(_ *cobra.Command, _ []string) error {
 	// Placeholder for post-action hooks that can be run by MicroCluster.
 	h := &config.Hooks{
 		// PreBootstrap is before after the daemon is initialized and bootstrapped.
-		PreBootstrap: func(_ *state.State, _ map[string]string) error {
+		PreBootstrap: func(_ *state.State, initConfig map[string]string) error {
 			logger.Info("This is a hook that runs before the daemon is initialized and bootstrapped")
 
+			// The username collation is fixed when the schema is first created.
+			collation, ok := initConfig[usernameCollationConfigKey]
+			if ok {
+				return database.SetUsernameCollation(collation)
+			}
+
 			return nil
 		},
 
 		// PostBootstrap is run after the daemon is initialized and bootstrapped.
-		PostBootstrap: func(_ *state.State, _ map[string]string) error {
+		PostBootstrap: func(s *state.State, _ map[string]string) error {
 			logger.Info("This is a hook that runs after the daemon is initialized and bootstrapped")
 
+			err := applyMigrations(s)
+			if err != nil {
+				return err
+			}
+
+			err = s.Database.Transaction(s.Context, database.PostBootstrapCheck)
+			if err != nil {
+				return fmt.Errorf("Post bootstrap check failed: %w", err)
+			}
+
 			return nil
 		},
 
 		// OnStart is run after the daemon is started.
-		OnStart: func(_ *state.State) error {
+		OnStart: func(s *state.State) error {
+			// The logger is set up by microcluster when starting, scrub tokens from everything logged from now on.
+			logger.Log = database.NewScrubbingLogger(logger.Log)
+
 			logger.Info("This is a hook that runs after the daemon first starts")
 
-			return nil
+			return applyMigrations(s)
 		},
 
 		// PostJoin is run after the daemon is initialized and joins a cluster.
-		PostJoin: func(_ *state.State, _ map[string]string) error {
+		PostJoin: func(s *state.State, _ map[string]string) error {
 			logger.Info("This is a hook that runs after the daemon is initialized and joins an existing cluster, after OnNewMember runs on all peers")
 
-			return nil
+			return applyMigrations(s)
 		},
 
 		// PreJoin is run after the daemon is initialized and joins a cluster.
@@ -118,10 +173,10 @@ func (c *cmdDaemon) Run(_ *cobra.Command, _ []string) error {
 		},
 
 		// OnHeartbeat is run after a successful heartbeat round.
-		OnHeartbeat: func(_ *state.State) error {
+		OnHeartbeat: func(s *state.State) error {
 			logger.Info("This is a hook that is run on the dqlite leader after a successful heartbeat")
 
-			return nil
+			return maintainDatabase(s)
 		},
 
 		// OnNewMember is run after a new member has joined.
@@ -135,6 +190,52 @@ func (c *cmdDaemon) Run(_ *cobra.Command, _ []string) error {
 	return m.Start(context.Background(), database.SchemaExtensions, nil, h)
 }
 
+// usernameCollationConfigKey is the bootstrap configuration key selecting the juju user username collation.
+const usernameCollationConfigKey = "jujuuser-username-collation"
+
+// applyMigrations verifies the juju user columns and applies the pending runtime database migrations once the
+// database is available.
+func applyMigrations(s *state.State) error {
+	if !s.Database.IsOpen() {
+		return nil
+	}
+
+	// Migrations run the juju user statements, which must match the schema.
+	err := s.Database.Transaction(s.Context, database.VerifyJujuUserColumns)
+	if err != nil {
+		return fmt.Errorf("Juju user schema verification failed: %w", err)
+	}
+
+	_, err = database.ApplyMigrations(s.Context, database.AuditedTransactor(s.Database.Transaction), database.JujuUserSchemaComponent, database.JujuUserMigrations)
+
+	return err
+}
+
+// maintenanceInterval is the minimum time between two runs of the database maintenance.
+const maintenanceInterval = 24 * time.Hour
+
+// lastMaintenance is when maintainDatabase last ran.
+var lastMaintenance time.Time
+var lastMaintenanceMu sync.Mutex
+
+// maintainDatabase runs the database maintenance if it did not run within maintenanceInterval.
+func maintainDatabase(s *state.State) error {
+	if !s.Database.IsOpen() {
+		return nil
+	}
+
+	lastMaintenanceMu.Lock()
+	defer lastMaintenanceMu.Unlock()
+
+	if time.Since(lastMaintenance) < maintenanceInterval {
+		return nil
+	}
+
+	lastMaintenance = time.Now()
+
+	return database.MaintainJujuUserTable(s.Context, s.Database.Transaction)
+}
+
 func init() {
 	rand.New(rand.NewSource(time.Now().UnixNano()))
 }
@@ -152,6 +253,17 @@ func main() {
 
 	app.PersistentFlags().StringVar(&daemonCmd.flagStateDir, "state-dir", "", "Path to store state information"+"``")
 	app.PersistentFlags().StringVar(&daemonCmd.flagSocketGroup, "socket-group", "", "Group to set socket's group ownership to")
+	app.PersistentFlags().Float64Var(&daemonCmd.flagJujuUserWriteRate, "jujuuser-write-rate", 0, "Maximum juju user write requests per second, 0 for unlimited, unless set with config key jujuuser.write-rate")
+	app.PersistentFlags().IntVar(&daemonCmd.flagJujuUserWriteBurst, "jujuuser-write-burst", 10, "Number of juju user write requests allowed in a burst, unless set with config key jujuuser.write-burst")
+	app.PersistentFlags().IntVar(&daemonCmd.flagJujuUserMaxBatchSize, "jujuuser-max-batch-size", database.DefaultMaxJujuUserBatchSize, "Maximum number of juju users in a single bulk request, 0 for unlimited")
+	app.PersistentFlags().IntVar(&daemonCmd.flagJujuUserMaxUsers, "jujuuser-max-users", 0, "Maximum number of juju users, 0 for unlimited")
+	app.PersistentFlags().StringSliceVar(&daemonCmd.flagJujuUserReservedUsernames, "jujuuser-reserved-username", database.DefaultReservedJujuUsernames, "Username of an internal juju user hidden from filtered listings, can be repeated")
+	app.PersistentFlags().BoolVar(&daemonCmd.flagJujuUserSkipNoOpTokenUpdates, "jujuuser-skip-noop-token-updates", true, "Skip writing juju user tokens set to the value they already have")
+	app.PersistentFlags().StringSliceVar(&daemonCmd.flagLogSensitiveFields, "log-sensitive-field", nil, "Name of a field to scrub from logs in addition to tokens, can be repeated")
+	app.PersistentFlags().StringVar(&daemonCmd.flagJujuUserTokenKeyFile, "jujuuser-token-key-file", "", "Path to the 32 bytes key juju user tokens are encrypted with")
+
+	jujuUserCmd := cmdJujuUser{daemon: &daemonCmd}
+	app.AddCommand(jujuUserCmd.Command())
 
 	app.SetVersionTemplate("{{.Version}}\n")
 
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/canonical/lxd/shared/logger"
+)
+
+// SystemActor is recorded as the actor of changes made without an acting principal in the context.
+const SystemActor = "system"
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx carrying the principal performing the database changes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the principal stored in ctx by WithActor, or SystemActor if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, ok := ctx.Value(actorContextKey{}).(string)
+	if !ok || actor == "" {
+		return SystemActor
+	}
+
+	return actor
+}
+
+// JujuUserAuditEvent describes a change made to a JujuUser.
+type JujuUserAuditEvent struct {
+	Actor    string
+	Action   string
+	Username string
+}
+
+// JujuUserAuditHook receives an event for every JujuUser change. By default events are logged.
+var JujuUserAuditHook = func(_ context.Context, event JujuUserAuditEvent) {
+	logger.Info("Juju user changed", logger.Ctx{"actor": event.Actor, "action": event.Action, "username": event.Username})
+}
+
+// jujuUserAuditBuffer holds the audit events of a transaction until it is committed.
+type jujuUserAuditBuffer struct {
+	mu     sync.Mutex
+	events []JujuUserAuditEvent
+}
+
+type auditBufferContextKey struct{}
+
+// AuditedTransactor returns a Transactor running transactions with transaction and only sending their audit
+// events to JujuUserAuditHook once they are committed, so that rolled back changes are never reported.
+func AuditedTransactor(transaction Transactor) Transactor {
+	return func(ctx context.Context, f func(context.Context, *sql.Tx) error) error {
+		buffer := &jujuUserAuditBuffer{}
+		ctx = context.WithValue(ctx, auditBufferContextKey{}, buffer)
+
+		err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			// Drop the events of a previous attempt should the transaction be retried.
+			buffer.mu.Lock()
+			buffer.events = nil
+			buffer.mu.Unlock()
+
+			return f(ctx, tx)
+		})
+		if err != nil {
+			return err
+		}
+
+		buffer.mu.Lock()
+		events := buffer.events
+		buffer.mu.Unlock()
+
+		for _, event := range events {
+			sendJujuUserAudit(ctx, event)
+		}
+
+		return nil
+	}
+}
+
+// emitJujuUserAudit records an audit event for the given action. Within a transaction run by AuditedTransactor
+// the event is held until the transaction is committed, otherwise it is sent to JujuUserAuditHook right away.
+func emitJujuUserAudit(ctx context.Context, action string, username string) {
+	event := JujuUserAuditEvent{Actor: ActorFromContext(ctx), Action: action, Username: username}
+
+	buffer, ok := ctx.Value(auditBufferContextKey{}).(*jujuUserAuditBuffer)
+	if ok {
+		buffer.mu.Lock()
+		buffer.events = append(buffer.events, event)
+		buffer.mu.Unlock()
+
+		return
+	}
+
+	sendJujuUserAudit(ctx, event)
+}
+
+// sendJujuUserAudit sends event to JujuUserAuditHook.
+func sendJujuUserAudit(ctx context.Context, event JujuUserAuditEvent) {
+	if JujuUserAuditHook == nil {
+		return
+	}
+
+	JujuUserAuditHook(ctx, event)
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// DefaultMaxJujuUserBatchSize is the default number of JujuUsers a single bulk operation may touch.
+const DefaultMaxJujuUserBatchSize = 1000
+
+// maxJujuUserBatchSize is the number of JujuUsers a single bulk operation may touch, zero for no limit.
+var maxJujuUserBatchSize = DefaultMaxJujuUserBatchSize
+var maxJujuUserBatchSizeMu sync.RWMutex
+
+// SetMaxJujuUserBatchSize sets the number of JujuUsers a single bulk operation may touch.
+// A size of zero disables the limit.
+func SetMaxJujuUserBatchSize(size int) {
+	maxJujuUserBatchSizeMu.Lock()
+	defer maxJujuUserBatchSizeMu.Unlock()
+
+	maxJujuUserBatchSize = size
+}
+
+// CheckJujuUserBatchSize returns a 400 StatusError if a bulk operation on size JujuUsers exceeds the configured limit.
+func CheckJujuUserBatchSize(size int) error {
+	maxJujuUserBatchSizeMu.RLock()
+	defer maxJujuUserBatchSizeMu.RUnlock()
+
+	if maxJujuUserBatchSize > 0 && size > maxJujuUserBatchSize {
+		return api.StatusErrorf(http.StatusBadRequest, "Batch of %d juju users exceeds the limit of %d, split the request into smaller chunks", size, maxJujuUserBatchSize)
+	}
+
+	return nil
+}
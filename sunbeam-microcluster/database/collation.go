@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Collations the jujuuser username column can be created with.
+const (
+	// UsernameCollationBinary makes usernames case sensitive, it is the default.
+	UsernameCollationBinary = "BINARY"
+
+	// UsernameCollationNoCase makes usernames case insensitive for ASCII letters, so that "Admin" and
+	// "admin" are the same user in lookups and uniqueness checks.
+	UsernameCollationNoCase = "NOCASE"
+)
+
+// usernameCollation is the collation JujuUserUsernameCollationSchemaUpdate creates the username column with.
+var usernameCollation = UsernameCollationBinary
+var usernameCollationMu sync.RWMutex
+
+// SetUsernameCollation selects the collation of the jujuuser username column, one of the UsernameCollation
+// constants matched ignoring case.
+// The collation is applied by a schema update, so it only takes effect when set before the database is
+// bootstrapped: it is fixed for the lifetime of the cluster and ignored on later starts and joins.
+// Choosing a collation other than binary fails the schema update of a database already holding juju users.
+func SetUsernameCollation(collation string) error {
+	collation = strings.ToUpper(collation)
+	if collation != UsernameCollationBinary && collation != UsernameCollationNoCase {
+		return fmt.Errorf("Invalid username collation %q, expected %q or %q", collation, UsernameCollationBinary, UsernameCollationNoCase)
+	}
+
+	usernameCollationMu.Lock()
+	defer usernameCollationMu.Unlock()
+
+	usernameCollation = collation
+
+	return nil
+}
+
+// currentUsernameCollation returns the collation set with SetUsernameCollation, only meaningful to the schema
+// update creating the database. Use UsernameCollation for the collation the database actually has.
+func currentUsernameCollation() string {
+	usernameCollationMu.RLock()
+	defer usernameCollationMu.RUnlock()
+
+	return usernameCollation
+}
+
+// usernameNoCase matches the definition of a case insensitive username column in the jujuuser schema.
+var usernameNoCase = regexp.MustCompile(`(?i)\busername\s+TEXT\b[^,]*\bCOLLATE\s+NOCASE\b`)
+
+// UsernameCollation returns the collation of the jujuuser username column, read from the schema within tx.
+// Unlike the setting of SetUsernameCollation it holds on every member and across restarts, as it is part of
+// the replicated database.
+func UsernameCollation(ctx context.Context, tx *sql.Tx) (string, error) {
+	var schema string
+	err := tx.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'jujuuser'").Scan(&schema)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the schema of table \"jujuuser\": %w", err)
+	}
+
+	if usernameNoCase.MatchString(schema) {
+		return UsernameCollationNoCase, nil
+	}
+
+	return UsernameCollationBinary, nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+// newTestDBWithCollation returns a test database whose username column was created with collation. The setting
+// of SetUsernameCollation is restored before returning, so the database is all that remembers the collation, as
+// after a restart or on a joining member.
+func newTestDBWithCollation(t *testing.T, collation string) *sql.DB {
+	t.Helper()
+
+	previous := currentUsernameCollation()
+	err := SetUsernameCollation(collation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = SetUsernameCollation(previous) }()
+
+	return newTestDB(t)
+}
+
+func TestUsernameCollation(t *testing.T) {
+	for _, collation := range []string{UsernameCollationBinary, UsernameCollationNoCase} {
+		t.Run(collation, func(t *testing.T) {
+			db := newTestDBWithCollation(t, collation)
+
+			mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+				got, err := UsernameCollation(ctx, tx)
+				if err != nil {
+					return err
+				}
+
+				if got != collation {
+					t.Errorf("Expected collation %q, got %q", collation, got)
+				}
+
+				return nil
+			})
+		})
+	}
+}
+
+func TestUsernameUniquenessFollowsCollation(t *testing.T) {
+	tests := []struct {
+		collation string
+		unique    bool
+	}{
+		{collation: UsernameCollationBinary, unique: false},
+		{collation: UsernameCollationNoCase, unique: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.collation, func(t *testing.T) {
+			db := newTestDBWithCollation(t, test.collation)
+			mustCreateJujuUser(t, db, JujuUser{Username: "Admin", Token: "token-1"})
+
+			err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+				_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "admin", Token: "token-2"})
+				return err
+			})
+
+			if test.unique {
+				assertStatus(t, err, http.StatusConflict)
+			} else if err != nil {
+				t.Fatalf("Expected %q and %q to be different users: %v", "Admin", "admin", err)
+			}
+		})
+	}
+}
+
+func TestValidateJujuUserImportFollowsCollation(t *testing.T) {
+	tests := []struct {
+		collation string
+		invalid   int
+	}{
+		{collation: UsernameCollationBinary, invalid: 0},
+		{collation: UsernameCollationNoCase, invalid: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.collation, func(t *testing.T) {
+			db := newTestDBWithCollation(t, test.collation)
+			users := []JujuUser{{Username: "Admin", Token: "token-1"}, {Username: "admin", Token: "token-2"}}
+
+			err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+				_, err := ImportJujuUsers(ctx, tx, users, ImportModeFail)
+				return err
+			})
+
+			if test.invalid == 0 {
+				if err != nil {
+					t.Fatalf("Expected the import to succeed: %v", err)
+				}
+
+				return
+			}
+
+			validationErr, ok := err.(*JujuUserImportValidationError)
+			if !ok {
+				t.Fatalf("Expected a validation error, got %v", err)
+			}
+
+			if len(validationErr.Rows) != test.invalid || validationErr.Rows[0].Row != 1 {
+				t.Errorf("Expected only row 1 to be invalid, got %+v", validationErr.Rows)
+			}
+		})
+	}
+}
+
+func TestDeleteJujuUsersByPrefixFollowsCollation(t *testing.T) {
+	tests := []struct {
+		collation string
+		matches   int
+	}{
+		{collation: UsernameCollationBinary, matches: 1},
+		{collation: UsernameCollationNoCase, matches: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.collation, func(t *testing.T) {
+			db := newTestDBWithCollation(t, test.collation)
+			mustCreateJujuUser(t, db, JujuUser{Username: "tenant-a", Token: "token-1"})
+			mustCreateJujuUser(t, db, JujuUser{Username: "TENANT-b", Token: "token-2"})
+			mustCreateJujuUser(t, db, JujuUser{Username: "other", Token: "token-3"})
+
+			mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+				deleted, err := DeleteJujuUsersByPrefix(ctx, tx, "tenant-", test.matches)
+				if err != nil {
+					return err
+				}
+
+				if deleted != test.matches {
+					t.Errorf("Expected %d deleted juju users, got %d", test.matches, deleted)
+				}
+
+				return nil
+			})
+		})
+	}
+}
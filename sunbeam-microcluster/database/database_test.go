@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/canonical/lxd/shared/api"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns a database with all the schema extensions applied, closed when the test ends.
+// Writers wait for each other as they do on dqlite rather than failing as busy.
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=10000&_journal_mode=WAL", path))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	for i, update := range SchemaExtensions {
+		err := testTransaction(db)(context.Background(), update)
+		if err != nil {
+			t.Fatalf("Failed to apply schema extension %d: %v", i+1, err)
+		}
+	}
+
+	return db
+}
+
+// testTransaction returns a Transactor running transactions on db, committed unless f fails.
+func testTransaction(db *sql.DB) Transactor {
+	return func(ctx context.Context, f func(context.Context, *sql.Tx) error) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		err = f(ctx, tx)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	}
+}
+
+// mustTransaction runs f in a transaction on db and fails the test on error.
+func mustTransaction(t testing.TB, db *sql.DB, f func(ctx context.Context, tx *sql.Tx) error) {
+	t.Helper()
+
+	err := testTransaction(db)(context.Background(), f)
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+}
+
+// mustCreateJujuUser creates the juju user username with token and fails the test on error.
+func mustCreateJujuUser(t *testing.T, db *sql.DB, user JujuUser) {
+	t.Helper()
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := CreateJujuUser(ctx, tx, user)
+		return err
+	})
+}
+
+// mustCreateJujuController adds the juju controller with the given ID and fails the test on error.
+func mustCreateJujuController(t *testing.T, db *sql.DB, id int64) {
+	t.Helper()
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO jujucontrollers (id, name) VALUES (?, ?)", id, fmt.Sprintf("controller-%d", id))
+		return err
+	})
+}
+
+// assertStatus fails the test unless err is a StatusError with the given status.
+func assertStatus(t *testing.T, err error, status int) {
+	t.Helper()
+
+	if !api.StatusErrorCheck(err, status) {
+		t.Fatalf("Expected a %d status error, got %v", status, err)
+	}
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// OutboxMaxAttempts is how many failed deliveries of an outbox event are recorded before it is dead-lettered.
+const OutboxMaxAttempts = 5
+
+// DeadLetter is an outbox event whose delivery kept failing, set aside so that it does not hold up the others.
+type DeadLetter struct {
+	ID        int64
+	EventID   int64
+	Username  string
+	Action    string
+	CreatedAt time.Time
+	FailedAt  time.Time
+	Attempts  int
+	LastError string
+}
+
+var outboxEventAttemptsIncrement = cluster.RegisterStmt(`
+UPDATE jujuuser_outbox SET attempts = attempts + 1 WHERE id = ? AND processed = 0
+`)
+
+var outboxEventAttempts = cluster.RegisterStmt(`
+SELECT jujuuser_outbox.attempts
+  FROM jujuuser_outbox
+  WHERE jujuuser_outbox.id = ?
+`)
+
+var deadLetterCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_dead_letters (event_id, username, action, created_at, failed_at, attempts, last_error)
+  SELECT jujuuser_outbox.id, jujuuser_outbox.username, jujuuser_outbox.action, jujuuser_outbox.created_at, ?, jujuuser_outbox.attempts, ?
+    FROM jujuuser_outbox
+    WHERE jujuuser_outbox.id = ? AND jujuuser_outbox.processed = 0
+`)
+
+var deadLetterObjects = cluster.RegisterStmt(`
+SELECT jujuuser_dead_letters.id, jujuuser_dead_letters.event_id, jujuuser_dead_letters.username, jujuuser_dead_letters.action,
+       jujuuser_dead_letters.created_at, jujuuser_dead_letters.failed_at, jujuuser_dead_letters.attempts, jujuuser_dead_letters.last_error
+  FROM jujuuser_dead_letters
+  ORDER BY jujuuser_dead_letters.id
+`)
+
+var deadLetterByID = cluster.RegisterStmt(`
+SELECT jujuuser_dead_letters.username, jujuuser_dead_letters.action
+  FROM jujuuser_dead_letters
+  WHERE jujuuser_dead_letters.id = ?
+`)
+
+var deadLetterDelete = cluster.RegisterStmt(`
+DELETE FROM jujuuser_dead_letters WHERE id = ?
+`)
+
+// RecordOutboxFailure records a failed delivery of the pending outbox event with the given ID. Once the event
+// failed OutboxMaxAttempts times, it is moved to the dead letters. It returns whether the event was dead-lettered.
+func RecordOutboxFailure(ctx context.Context, tx *sql.Tx, id int64, deliveryErr string) (bool, error) {
+	stmt, err := prepareStmt(ctx, tx, outboxEventAttemptsIncrement)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get \"outboxEventAttemptsIncrement\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("Failed to update \"jujuuser_outbox\" entry %d: %w", id, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Fetch affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return false, api.StatusErrorf(http.StatusNotFound, "Pending outbox event %d not found", id)
+	}
+
+	stmt, err = prepareStmt(ctx, tx, outboxEventAttempts)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get \"outboxEventAttempts\" prepared statement: %w", err)
+	}
+
+	var attempts int
+	err = stmt.QueryRowContext(ctx, id).Scan(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get attempts of \"jujuuser_outbox\" entry %d: %w", id, err)
+	}
+
+	if attempts < OutboxMaxAttempts {
+		return false, nil
+	}
+
+	err = MoveToDeadLetter(ctx, tx, id, deliveryErr)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MoveToDeadLetter sets the pending outbox event with the given ID aside as a dead letter, along with the reason
+// its delivery failed. The event is flagged as processed rather than deleted, so that it no longer holds up the
+// pending events while the sequence replayed by GetOutboxEventsSince stays gapless.
+func MoveToDeadLetter(ctx context.Context, tx *sql.Tx, id int64, reason string) error {
+	stmt, err := prepareStmt(ctx, tx, deadLetterCreate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"deadLetterCreate\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, time.Now().UTC(), reason, id)
+	if err != nil {
+		return fmt.Errorf("Failed to create \"jujuuser_dead_letters\" entry for event %d: %w", id, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "Pending outbox event %d not found", id)
+	}
+
+	return MarkOutboxProcessed(ctx, tx, id)
+}
+
+// ListDeadLetters returns all dead letters, oldest first.
+func ListDeadLetters(ctx context.Context, tx *sql.Tx) ([]DeadLetter, error) {
+	stmt, err := prepareStmt(ctx, tx, deadLetterObjects)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"deadLetterObjects\" prepared statement: %w", err)
+	}
+
+	letters := make([]DeadLetter, 0)
+
+	dest := func(scan func(dest ...any) error) error {
+		l := DeadLetter{}
+		err := scan(&l.ID, &l.EventID, &l.Username, &l.Action, &l.CreatedAt, &l.FailedAt, &l.Attempts, &l.LastError)
+		if err != nil {
+			return err
+		}
+
+		letters = append(letters, l)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_dead_letters\" table: %w", err)
+	}
+
+	return letters, nil
+}
+
+// ReplayDeadLetter queues the change of the dead letter with the given ID again, as a new outbox event starting
+// over with no failed attempts, and removes the dead letter.
+func ReplayDeadLetter(ctx context.Context, tx *sql.Tx, id int64) error {
+	stmt, err := prepareStmt(ctx, tx, deadLetterByID)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"deadLetterByID\" prepared statement: %w", err)
+	}
+
+	var username, action string
+	err = stmt.QueryRowContext(ctx, id).Scan(&username, &action)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.StatusErrorf(http.StatusNotFound, "Dead letter %d not found", id)
+	} else if err != nil {
+		return fmt.Errorf("Failed to get \"jujuuser_dead_letters\" entry %d: %w", id, err)
+	}
+
+	err = appendOutboxEvent(ctx, tx, action, username)
+	if err != nil {
+		return err
+	}
+
+	stmt, err = prepareStmt(ctx, tx, deadLetterDelete)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"deadLetterDelete\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete \"jujuuser_dead_letters\" entry %d: %w", id, err)
+	}
+
+	return nil
+}
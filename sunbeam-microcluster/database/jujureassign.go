@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuControllerID = cluster.RegisterStmt(`
+SELECT jujucontrollers.id FROM jujucontrollers
+  WHERE jujucontrollers.id = ?
+`)
+
+var jujuUserUsernamesByControllerID = cluster.RegisterStmt(`
+SELECT jujuuser.username FROM jujuuser
+  WHERE jujuuser.controller_id = ?
+  ORDER BY jujuuser.username
+`)
+
+var jujuUserControllerUpdateByID = cluster.RegisterStmt(`
+UPDATE jujuuser
+  SET controller_id = ?, updated_at = ?
+ WHERE id = ?
+`)
+
+// ReassignJujuUsers moves the JujuUsers with the given usernames from controller fromController to
+// toController, or all of its users when usernames is empty. It returns the number of moved users.
+// Nothing is moved if any of the users does not exist in fromController or is already taken in toController.
+func ReassignJujuUsers(ctx context.Context, tx *sql.Tx, fromController int64, toController int64, usernames []string) (int, error) {
+	err := CheckJujuUserBatchSize(len(usernames))
+	if err != nil {
+		return 0, err
+	}
+
+	if fromController == toController {
+		return 0, nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuControllerID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuControllerID\" prepared statement: %w", err)
+	}
+
+	var id int64
+	err = stmt.QueryRowContext(ctx, toController).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, api.StatusErrorf(http.StatusNotFound, "Juju controller %d not found", toController)
+	} else if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujucontrollers\" ID: %w", err)
+	}
+
+	if len(usernames) == 0 {
+		stmt, err := prepareStmt(ctx, tx, jujuUserUsernamesByControllerID)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to get \"jujuUserUsernamesByControllerID\" prepared statement: %w", err)
+		}
+
+		dest := func(scan func(dest ...any) error) error {
+			var username string
+			err := scan(&username)
+			if err != nil {
+				return err
+			}
+
+			usernames = append(usernames, username)
+
+			return nil
+		}
+
+		err = query.SelectObjects(ctx, stmt, dest, fromController)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+		}
+	}
+
+	idStmt, err := prepareStmt(ctx, tx, jujuUserIDByControllerIDAndUsername)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserIDByControllerIDAndUsername\" prepared statement: %w", err)
+	}
+
+	// Resolve and check every user first so that collisions are reported before anything is written.
+	ids := make([]int64, 0, len(usernames))
+	for _, username := range usernames {
+		var id int64
+		err := idStmt.QueryRowContext(ctx, fromController, username).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found in juju controller %d", username, fromController)
+		} else if err != nil {
+			return 0, fmt.Errorf("Failed to get \"jujuuser\" ID: %w", err)
+		}
+
+		var existingID int64
+		err = idStmt.QueryRowContext(ctx, toController, username).Scan(&existingID)
+		if err == nil {
+			return 0, api.StatusErrorf(http.StatusConflict, "JujuUser %q already exists in juju controller %d", username, toController)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("Failed to check for duplicates: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserControllerUpdateByID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserControllerUpdateByID\" prepared statement: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for i, id := range ids {
+		_, err := stmt.ExecContext(ctx, toController, now, id)
+		if err != nil {
+			return 0, fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+		}
+
+		err = recordJujuUserChange(ctx, tx, "reassign", usernames[i])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), nil
+}
@@ -1,5 +1,23 @@
 package database
 
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/lxd/shared/logger"
+	"github.com/canonical/microcluster/cluster"
+)
+
 //go:generate -command mapper lxd-generate db mapper -t jujuuser.mapper.go
 //go:generate mapper reset
 //
@@ -10,22 +28,1302 @@ package database
 //go:generate mapper stmt -d github.com/canonical/microcluster/cluster -e JujuUser delete-by-Username table=jujuuser
 //go:generate mapper stmt -d github.com/canonical/microcluster/cluster -e JujuUser update table=jujuuser
 //
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser GetMany table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser GetOne table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser ID table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser Exists table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser Create table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser DeleteOne-by-Username table=jujuuser
-//go:generate mapper method -i -d github.com/canonical/microcluster/cluster -e JujuUser Update table=jujuuser
+// Only the statements are generated, jujuuser.mapper.go is never edited by hand. The methods are written below
+// rather than generated as they seal tokens, check controllers and resolve duplicates. Statements that
+// lxd-generate can't express are registered next to the methods using them.
 
 // JujuUser is used to track User and registration token information.
+// Every JujuUser belongs to a controller, legacy users are assigned to DefaultJujuControllerID. Usernames are
+// unique per controller: the lookups only taking a username fail with ambiguousJujuUsernameError when it
+// exists under several controllers, see GetJujuUserInController for the controller scoped ones.
 type JujuUser struct {
-	ID       int
-	Username string `db:"primary=yes"`
-	Token    string
+	ID           int
+	Username     string `db:"primary=yes"`
+	Token        string
+	ControllerID int64
+	CreatedAt    time.Time `db:"omit=update"`
+	UpdatedAt    time.Time
+
+	// TokenKeyVersion identifies the key the stored token is encrypted with, empty for plain text.
+	// Token always holds the plain text.
+	TokenKeyVersion string
+
+	// DisplayName is a human friendly label for the user, stored as NULL when empty.
+	DisplayName string
+
+	// TokenMeta is free-form JSON metadata about the token, such as its issuer or scopes, stored as NULL when empty.
+	TokenMeta json.RawMessage
+
+	// TokenFingerprint is a short digest of Token, see TokenFingerprint, computed from Token on every write.
+	// It references the token in logs and API responses without exposing it.
+	TokenFingerprint string
+
+	// TokenSet is false when the token column is NULL, Token is then empty.
+	TokenSet bool `db:"ignore"`
+
+	// TokenUnavailable is set when the token is encrypted but the key is missing, Token is then empty.
+	TokenUnavailable bool `db:"ignore"`
 }
 
 // JujuUserFilter is a required struct for use with lxd-generate. It is used for filtering fields on database fetches.
+// Fields set within a filter are AND'ed together. Fields ignored by lxd-generate are only handled by jujuUserFilterClause.
 type JujuUserFilter struct {
-	Username *string
+	Username     *string
+	DisplayName  *string
+	ControllerID *int64
+	HasToken     *bool   `db:"ignore"`
+	LabelKey     *string `db:"ignore"`
+	LabelValue   *string `db:"ignore"`
+
+	// ExcludeReserved leaves out the JujuUsers with a username set with SetReservedJujuUsernames.
+	ExcludeReserved bool `db:"ignore"`
+}
+
+// DefaultJujuControllerID is the controller JujuUsers belong to when none is given.
+const DefaultJujuControllerID int64 = 1
+
+var jujuUserIDByControllerIDAndUsername = cluster.RegisterStmt(`
+SELECT jujuuser.id FROM jujuuser
+  WHERE jujuuser.controller_id = ? AND jujuuser.username = ?
+`)
+
+var jujuUserTokenByUsername = cluster.RegisterStmt(`
+SELECT jujuuser.token, jujuuser.token_key_version FROM jujuuser
+  WHERE jujuuser.username = ?
+`)
+
+var jujuUserObjectsByIDRange = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.id >= ? AND jujuuser.id < ? )
+  ORDER BY jujuuser.id
+`, jujuUserColumns()))
+
+var jujuUserObjectsAfterUsername = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.username > ? )
+  ORDER BY jujuuser.username, jujuuser.id
+  LIMIT ?
+`, jujuUserColumns()))
+
+var jujuUserObjectsByCreatedAtRange = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.created_at >= ? AND jujuuser.created_at < ? )
+  ORDER BY jujuuser.created_at
+`, jujuUserColumns()))
+
+// jujuUserLock is a write that changes nothing, used to take the write lock ahead of a read.
+var jujuUserLock = cluster.RegisterStmt(`
+UPDATE jujuuser SET id = id WHERE username = ?
+`)
+
+// jujuUserTableLock is a write matching no row, it takes the write lock without changing any page.
+var jujuUserTableLock = cluster.RegisterStmt(`
+UPDATE jujuuser SET id = id WHERE id IS NULL
+`)
+
+var jujuUserTokenUpdateByID = cluster.RegisterStmt(`
+UPDATE jujuuser
+  SET token = ?, token_key_version = ?, updated_at = ?, token_fingerprint = ?
+ WHERE id = ?
+`)
+
+var jujuUserDeleteByID = cluster.RegisterStmt(`
+DELETE FROM jujuuser WHERE id = ?
+`)
+
+var jujuUserNames = cluster.RegisterStmt(`
+SELECT jujuuser.username
+  FROM jujuuser
+  ORDER BY jujuuser.username
+`)
+
+// jujuUserColumns returns a string of column names to be used with a SELECT statement for the entity.
+// Use this function when building statements to retrieve database entries matching the JujuUser entity.
+func jujuUserColumns() string {
+	return "jujuuser.id, jujuuser.username, jujuuser.token, jujuuser.controller_id, jujuuser.created_at, jujuuser.updated_at, jujuuser.token_key_version, jujuuser.display_name, jujuuser.token_meta, jujuuser.token_fingerprint"
+}
+
+// scanJujuUser scans a row selected with jujuUserColumns into a JujuUser.
+// A NULL token is returned as an empty Token with TokenSet unset, encrypted tokens are decrypted.
+// In degraded mode encrypted tokens are returned empty with TokenUnavailable set instead of failing the scan.
+func scanJujuUser(scan func(dest ...any) error) (JujuUser, error) {
+	j := JujuUser{}
+	var token sql.NullString
+	var displayName, tokenMeta sql.NullString
+
+	err := scan(&j.ID, &j.Username, &token, &j.ControllerID, &j.CreatedAt, &j.UpdatedAt, &j.TokenKeyVersion, &displayName, &tokenMeta, &j.TokenFingerprint)
+	if err != nil {
+		return j, err
+	}
+
+	j.DisplayName = displayName.String
+	j.TokenMeta = rawTokenMeta(tokenMeta)
+
+	j.Token, err = openToken(token.String, j.TokenKeyVersion)
+	if errors.Is(err, errTokenKeyUnavailable) {
+		j.TokenUnavailable = true
+	} else if err != nil {
+		return j, fmt.Errorf("Failed to read token of juju user %q: %w", j.Username, err)
+	}
+
+	j.TokenSet = token.Valid
+
+	return j, nil
+}
+
+// getJujuUsers can be used to run handwritten sql.Stmts to return a slice of objects.
+func getJujuUsers(ctx context.Context, stmt *sql.Stmt, args ...any) ([]JujuUser, error) {
+	objects, err := GetObjects(ctx, stmt, scanJujuUser, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return objects, nil
+}
+
+// getJujuUsersRaw can be used to run handwritten query strings to return a slice of objects.
+func getJujuUsersRaw(ctx context.Context, tx *sql.Tx, sql string, args ...any) ([]JujuUser, error) {
+	objects, err := GetObjectsRaw(ctx, tx, sql, scanJujuUser, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return objects, nil
+}
+
+// WalkJujuUsers calls f with every JujuUser in username order, as the rows are read, so that large tables are
+// never held in memory at once. An error returned by f stops the walk and is returned.
+func WalkJujuUsers(ctx context.Context, tx *sql.Tx, f func(JujuUser) error) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjects)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserObjects\" prepared statement: %w", err)
+	}
+
+	dest := func(scan func(dest ...any) error) error {
+		object, err := scanJujuUser(scan)
+		if err != nil {
+			return err
+		}
+
+		return f(object)
+	}
+
+	return query.SelectObjects(ctx, stmt, dest)
+}
+
+// recordJujuUserChange appends a JujuUser change to the outbox and the user history within tx, counts it in
+// the lifetime stats and emits its audit event.
+func recordJujuUserChange(ctx context.Context, tx *sql.Tx, action string, username string) error {
+	err := appendOutboxEvent(ctx, tx, action, username)
+	if err != nil {
+		return err
+	}
+
+	err = countJujuUserLifetimeChange(ctx, tx, action)
+	if err != nil {
+		return err
+	}
+
+	err = appendJujuUserHistory(ctx, tx, action, username)
+	if err != nil {
+		return err
+	}
+
+	emitJujuUserAudit(ctx, action, username)
+
+	return nil
+}
+
+// jujuUserObjectsTemplate is the query used when more than one filter is passed to GetJujuUsers.
+// The WHERE clause is assembled exclusively from jujuUserFilterClause fragments, which never
+// embed values, so every value is bound through a placeholder.
+const jujuUserObjectsTemplate = `
+SELECT %s
+  FROM jujuuser
+  WHERE %s
+  ORDER BY jujuuser.username
+`
+
+// jujuUserSortColumns maps the sort fields accepted by GetJujuUsersSorted to their columns.
+// Only these columns can ever end up in the ORDER BY clause.
+var jujuUserSortColumns = map[string]string{
+	"username":   "jujuuser.username",
+	"id":         "jujuuser.id",
+	"created_at": "jujuuser.created_at",
+}
+
+// GetJujuUsersSorted returns all JujuUsers ordered by the given sort field and order.
+// An empty sort field orders by username and an empty order is ascending.
+func GetJujuUsersSorted(ctx context.Context, tx *sql.Tx, sort string, order string) ([]JujuUser, error) {
+	if sort == "" {
+		sort = "username"
+	}
+
+	column, ok := jujuUserSortColumns[sort]
+	if !ok {
+		return nil, api.StatusErrorf(http.StatusBadRequest, "Invalid juju user sort field %q", sort)
+	}
+
+	direction := ""
+	switch order {
+	case "", "asc":
+		direction = "ASC"
+	case "desc":
+		direction = "DESC"
+	default:
+		return nil, api.StatusErrorf(http.StatusBadRequest, "Invalid juju user sort order %q", order)
+	}
+
+	// Tie-break on the id so the order is stable for non-unique columns.
+	queryStr := fmt.Sprintf("SELECT %s FROM jujuuser ORDER BY %s %s, jujuuser.id %s", jujuUserColumns(), column, direction, direction)
+
+	objects, err := getJujuUsersRaw(ctx, tx, queryStr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return objects, nil
+}
+
+// jujuUserFilterClause returns the parameterized WHERE fragment and arguments for a single filter.
+// The fields set within a filter are AND'ed together.
+func jujuUserFilterClause(filter JujuUserFilter) (string, []any, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if filter.Username != nil {
+		conditions = append(conditions, "jujuuser.username = ?")
+		args = append(args, filter.Username)
+	}
+
+	if filter.DisplayName != nil {
+		conditions = append(conditions, "jujuuser.display_name = ?")
+		args = append(args, filter.DisplayName)
+	}
+
+	if filter.ControllerID != nil {
+		conditions = append(conditions, "jujuuser.controller_id = ?")
+		args = append(args, filter.ControllerID)
+	}
+
+	if filter.HasToken != nil {
+		if *filter.HasToken {
+			conditions = append(conditions, "COALESCE(jujuuser.token, '') != ''")
+		} else {
+			conditions = append(conditions, "COALESCE(jujuuser.token, '') = ''")
+		}
+	}
+
+	if filter.LabelKey != nil || filter.LabelValue != nil {
+		if filter.LabelKey == nil {
+			return "", nil, fmt.Errorf("Cannot filter on a label value without a label key")
+		}
+
+		label := "EXISTS ( SELECT 1 FROM jujuuser_labels WHERE jujuuser_labels.jujuuser_id = jujuuser.id AND jujuuser_labels.key = ?"
+		args = append(args, filter.LabelKey)
+		if filter.LabelValue != nil {
+			label += " AND jujuuser_labels.value = ?"
+			args = append(args, filter.LabelValue)
+		}
+
+		conditions = append(conditions, label+" )")
+	}
+
+	if filter.ExcludeReserved {
+		reserved := ReservedJujuUsernames()
+		if len(reserved) > 0 {
+			conditions = append(conditions, fmt.Sprintf("jujuuser.username NOT IN %s", query.Params(len(reserved))))
+			for _, username := range reserved {
+				args = append(args, username)
+			}
+		} else {
+			// Nothing to leave out, the filter still matches every JujuUser.
+			conditions = append(conditions, "1 = 1")
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, fmt.Errorf("Cannot filter on empty JujuUserFilter")
+	}
+
+	return "( " + strings.Join(conditions, " AND ") + " )", args, nil
+}
+
+// nullTokenMeta returns the value to store for the token metadata meta, NULL when it is empty or JSON null.
+func nullTokenMeta(meta json.RawMessage) any {
+	if len(meta) == 0 || string(meta) == "null" {
+		return nil
+	}
+
+	return string(meta)
+}
+
+// rawTokenMeta returns the token metadata read from the database, nil when it is NULL or empty.
+func rawTokenMeta(meta sql.NullString) json.RawMessage {
+	if meta.String == "" {
+		return nil
+	}
+
+	return json.RawMessage(meta.String)
+}
+
+// nullString returns value for storage in a nullable column, the empty string being stored as NULL.
+func nullString(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+// jujuUserControllerID returns the controller ID to store for id, a zero ID selecting DefaultJujuControllerID as
+// on create since every entry belongs to a controller.
+func jujuUserControllerID(id int64) int64 {
+	if id == 0 {
+		return DefaultJujuControllerID
+	}
+
+	return id
+}
+
+// SearchJujuUsersByDisplayName returns the JujuUsers whose display name contains text, ignoring case.
+func SearchJujuUsersByDisplayName(ctx context.Context, tx *sql.Tx, text string) ([]JujuUser, error) {
+	// Match the wildcards of LIKE literally.
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+
+	return getJujuUsersRaw(ctx, tx, fmt.Sprintf(jujuUserObjectsTemplate, jujuUserColumns(), `( jujuuser.display_name LIKE ? ESCAPE '\' )`), "%"+pattern+"%")
+}
+
+// GetJujuUsers returns all available JujuUsers.
+// Multiple filters are OR'ed together, the fields set within each of them are AND'ed.
+func GetJujuUsers(ctx context.Context, tx *sql.Tx, filters ...JujuUserFilter) ([]JujuUser, error) {
+	ctx, span := startJujuUserSpan(ctx, "list", "")
+	objects, err := selectJujuUsers(ctx, tx, filters...)
+	span.End(err)
+
+	return objects, err
+}
+
+// selectJujuUsers is GetJujuUsers without tracing.
+func selectJujuUsers(ctx context.Context, tx *sql.Tx, filters ...JujuUserFilter) ([]JujuUser, error) {
+	var err error
+
+	// Result slice.
+	objects := make([]JujuUser, 0)
+
+	// Pick the prepared statement and arguments to use based on active criteria.
+	var sqlStmt *sql.Stmt
+	args := []any{}
+
+	switch {
+	case len(filters) == 0:
+		sqlStmt, err = prepareStmt(ctx, tx, jujuUserObjects)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get \"jujuUserObjects\" prepared statement: %w", err)
+		}
+
+		objects, err = getJujuUsers(ctx, sqlStmt)
+	case len(filters) == 1 && filters[0].Username != nil && filters[0] == JujuUserFilter{Username: filters[0].Username}:
+		sqlStmt, err = prepareStmt(ctx, tx, jujuUserObjectsByUsername)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByUsername\" prepared statement: %w", err)
+		}
+
+		objects, err = getJujuUsers(ctx, sqlStmt, filters[0].Username)
+	default:
+		clauses := make([]string, 0, len(filters))
+		for _, filter := range filters {
+			clause, clauseArgs, err := jujuUserFilterClause(filter)
+			if err != nil {
+				return nil, err
+			}
+
+			clauses = append(clauses, clause)
+			args = append(args, clauseArgs...)
+		}
+
+		queryStr := fmt.Sprintf(jujuUserObjectsTemplate, jujuUserColumns(), strings.Join(clauses, " OR "))
+		objects, err = getJujuUsersRaw(ctx, tx, queryStr, args...)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return objects, nil
+}
+
+// GetJujuUser returns the JujuUser with the given key.
+// JujuUsers are read from the database on every call rather than from a cache warmed up when a member becomes
+// leader: entries hold decrypted tokens, and a cache in one daemon would not see the writes made through the others.
+func GetJujuUser(ctx context.Context, tx *sql.Tx, username string) (*JujuUser, error) {
+	return GetJujuUserWithRepair(ctx, tx, username, false)
+}
+
+// GetJujuUserWithRepair returns the JujuUser with the given key.
+// If several entries match, a conflict error is returned unless repair is set, in which case the entry
+// with the lowest ID is kept and all other matching entries are deleted. Entries only count as duplicates
+// within the same controller: entries under different controllers are never deleted and still conflict.
+func GetJujuUserWithRepair(ctx context.Context, tx *sql.Tx, username string, repair bool) (*JujuUser, error) {
+	ctx, span := startJujuUserSpan(ctx, "get", username)
+	object, err := getJujuUserWithRepair(ctx, tx, username, repair)
+	span.End(err)
+
+	return object, err
+}
+
+// getJujuUserWithRepair is GetJujuUserWithRepair without tracing.
+func getJujuUserWithRepair(ctx context.Context, tx *sql.Tx, username string, repair bool) (*JujuUser, error) {
+	objects, err := selectJujuUsers(ctx, tx, JujuUserByUsername(username))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch JujuUser %q from \"jujuuser\" table: %w", username, err)
+	}
+
+	switch len(objects) {
+	case 0:
+		return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	case 1:
+		return &objects[0], nil
+	}
+
+	for _, object := range objects {
+		if object.ControllerID != objects[0].ControllerID {
+			return nil, ambiguousJujuUsernameError(username)
+		}
+	}
+
+	if !repair {
+		return nil, api.StatusErrorf(http.StatusConflict, "More than one \"jujuuser\" entry matches username %q", username)
+	}
+
+	keep := 0
+	for i, object := range objects {
+		if object.ID < objects[keep].ID {
+			keep = i
+		}
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteByID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserDeleteByID\" prepared statement: %w", err)
+	}
+
+	for i, object := range objects {
+		if i == keep {
+			continue
+		}
+
+		_, err = stmt.ExecContext(ctx, object.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to delete duplicate \"jujuuser\" entry %d of %q: %w", object.ID, username, err)
+		}
+	}
+
+	logger.Warn("Removed duplicate juju user entries", logger.Ctx{"username": username, "removed": len(objects) - 1})
+
+	return &objects[keep], nil
+}
+
+// ambiguousJujuUsernameError returns the conflict error of a lookup by username alone matching the entries of
+// several controllers.
+func ambiguousJujuUsernameError(username string) error {
+	return api.StatusErrorf(http.StatusConflict, "JujuUser %q exists under several controllers, a controller must be given", username)
+}
+
+// GetJujuUserID return the ID of the JujuUser with the given key.
+// It fails with a conflict error if the username exists under several controllers.
+func GetJujuUserID(ctx context.Context, tx *sql.Tx, username string) (int64, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserID)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"jujuUserID\" prepared statement: %w", err)
+	}
+
+	ids := []int64{}
+	dest := func(scan func(dest ...any) error) error {
+		var id int64
+		err := scan(&id)
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, username)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"jujuuser\" ID: %w", err)
+	}
+
+	switch len(ids) {
+	case 0:
+		return -1, api.StatusErrorf(http.StatusNotFound, "JujuUser not found")
+	case 1:
+		return ids[0], nil
+	default:
+		return -1, ambiguousJujuUsernameError(username)
+	}
+}
+
+// JujuUserExists checks if a JujuUser with the given key exists, under any controller.
+func JujuUserExists(ctx context.Context, tx *sql.Tx, username string) (bool, error) {
+	_, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+
+		if api.StatusErrorCheck(err, http.StatusConflict) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetJujuUsersByIDRange returns the JujuUsers with minID <= ID < maxID, ordered by ID.
+func GetJujuUsersByIDRange(ctx context.Context, tx *sql.Tx, minID int64, maxID int64) ([]JujuUser, error) {
+	if minID >= maxID {
+		return []JujuUser{}, nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByIDRange)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByIDRange\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, minID, maxID)
+}
+
+// GetJujuUsersPage returns up to limit JujuUsers with a username sorting after the given one, ordered by username.
+// It also returns the cursor to pass as after to get the next page, empty once there are no more users.
+// Paging by username keeps pages consistent when users are added between two fetches.
+func GetJujuUsersPage(ctx context.Context, tx *sql.Tx, after string, limit int) ([]JujuUser, string, error) {
+	if limit <= 0 {
+		return nil, "", api.StatusErrorf(http.StatusBadRequest, "Invalid juju user page limit %d", limit)
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsAfterUsername)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to get \"jujuUserObjectsAfterUsername\" prepared statement: %w", err)
+	}
+
+	// Fetch one more user than requested to know whether there is a next page.
+	objects, err := getJujuUsers(ctx, stmt, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(objects) <= limit {
+		return objects, "", nil
+	}
+
+	objects = objects[:limit]
+
+	return objects, objects[limit-1].Username, nil
+}
+
+// ListJujuUsernames returns the usernames of all JujuUsers, in the same order as GetJujuUsers.
+// Only the username column is read, tokens are never fetched.
+func ListJujuUsernames(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserNames)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserNames\" prepared statement: %w", err)
+	}
+
+	usernames := []string{}
+	dest := func(scan func(dest ...any) error) error {
+		var username string
+		err := scan(&username)
+		if err != nil {
+			return err
+		}
+
+		usernames = append(usernames, username)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return usernames, nil
+}
+
+// GetJujuUsersCreatedBetween returns the JujuUsers created at or after start and before end, ordered by creation time.
+func GetJujuUsersCreatedBetween(ctx context.Context, tx *sql.Tx, start time.Time, end time.Time) ([]JujuUser, error) {
+	if start.After(end) {
+		return []JujuUser{}, nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByCreatedAtRange)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByCreatedAtRange\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, start.UTC(), end.UTC())
+}
+
+// JujuUsersExist reports for every given username whether a JujuUser with that username exists.
+func JujuUsersExist(ctx context.Context, tx *sql.Tx, usernames []string) (map[string]bool, error) {
+	present := make(map[string]bool, len(usernames))
+	if len(usernames) == 0 {
+		return present, nil
+	}
+
+	args := make([]any, 0, len(usernames))
+	for _, username := range usernames {
+		present[username] = false
+		args = append(args, username)
+	}
+
+	stmt := fmt.Sprintf("SELECT jujuuser.username FROM jujuuser WHERE jujuuser.username IN %s", query.Params(len(args)))
+
+	dest := func(scan func(dest ...any) error) error {
+		var username string
+		err := scan(&username)
+		if err != nil {
+			return err
+		}
+
+		present[username] = true
+
+		return nil
+	}
+
+	err := query.Scan(ctx, tx, stmt, dest, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	return present, nil
+}
+
+// GetJujuUserToken returns only the token of the JujuUser with the given username.
+func GetJujuUserToken(ctx context.Context, tx *sql.Tx, username string) (string, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokenByUsername)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get \"jujuUserTokenByUsername\" prepared statement: %w", err)
+	}
+
+	var token sql.NullString
+	var version string
+	found := 0
+	dest := func(scan func(dest ...any) error) error {
+		found++
+
+		return scan(&token, &version)
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, username)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get \"jujuuser\" token: %w", err)
+	}
+
+	switch found {
+	case 0:
+		return "", api.StatusErrorf(http.StatusNotFound, "JujuUser not found")
+	case 1:
+		return openToken(token.String, version)
+	default:
+		return "", ambiguousJujuUsernameError(username)
+	}
+}
+
+// CreateJujuUserOptions tunes CreateJujuUserWithOptions.
+type CreateJujuUserOptions struct {
+	// SkipDuplicateCheck saves the lookup for an existing entry before inserting, for callers that know
+	// the user is new. Duplicates are then caught by the unique constraint instead.
+	SkipDuplicateCheck bool
+}
+
+// isUniqueConstraintError reports whether err is the violation of a UNIQUE constraint.
+func isUniqueConstraintError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// CreateJujuUser adds a new JujuUser to the database.
+// Usernames only need to be unique within a controller, a zero ControllerID selects DefaultJujuControllerID.
+// Creating a JujuUser beyond the limit set with SetMaxJujuUsers fails with a forbidden error.
+func CreateJujuUser(ctx context.Context, tx *sql.Tx, object JujuUser) (int64, error) {
+	return CreateJujuUserWithOptions(ctx, tx, object, CreateJujuUserOptions{})
+}
+
+// CreateJujuUserWithOptions adds a new JujuUser to the database like CreateJujuUser.
+// Either way an existing entry results in a conflict error.
+func CreateJujuUserWithOptions(ctx context.Context, tx *sql.Tx, object JujuUser, opts CreateJujuUserOptions) (int64, error) {
+	ctx, span := startJujuUserSpan(ctx, "create", object.Username)
+	id, err := createJujuUserWithOptions(ctx, tx, object, opts)
+	span.End(err)
+
+	return id, err
+}
+
+// createJujuUserWithOptions is CreateJujuUserWithOptions without tracing.
+func createJujuUserWithOptions(ctx context.Context, tx *sql.Tx, object JujuUser, opts CreateJujuUserOptions) (int64, error) {
+	err := CheckJujuUserRouteName(object.Username)
+	if err != nil {
+		return -1, err
+	}
+
+	object.ControllerID = jujuUserControllerID(object.ControllerID)
+
+	if !opts.SkipDuplicateCheck {
+		// Check if a JujuUser with the same key exists within the controller.
+		stmt, err := prepareStmt(ctx, tx, jujuUserIDByControllerIDAndUsername)
+		if err != nil {
+			return -1, fmt.Errorf("Failed to get \"jujuUserIDByControllerIDAndUsername\" prepared statement: %w", err)
+		}
+
+		var existingID int64
+		err = stmt.QueryRowContext(ctx, object.ControllerID, object.Username).Scan(&existingID)
+		if err == nil {
+			return -1, api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return -1, fmt.Errorf("Failed to check for duplicates: %w", err)
+		}
+	}
+
+	err = checkJujuUserLimit(ctx, tx)
+	if err != nil {
+		return -1, err
+	}
+
+	token, version, err := sealToken(object.Token)
+	if err != nil {
+		return -1, err
+	}
+
+	now := time.Now().UTC()
+	args := make([]any, 9)
+
+	// Populate the statement arguments.
+	args[0] = object.Username
+	args[1] = token
+	args[2] = object.ControllerID
+	args[3] = now
+	args[4] = now
+	args[5] = version
+	args[6] = nullString(object.DisplayName)
+	args[7] = nullTokenMeta(object.TokenMeta)
+	args[8] = TokenFingerprint(object.Token)
+
+	// Prepared statement to use.
+	stmt, err := prepareStmt(ctx, tx, jujuUserCreate)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"jujuUserCreate\" prepared statement: %w", err)
+	}
+
+	// Execute the statement.
+	result, err := stmt.ExecContext(ctx, args...)
+	if isUniqueConstraintError(err) {
+		return -1, api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+	} else if err != nil {
+		return -1, fmt.Errorf("Failed to create \"jujuuser\" entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("Failed to fetch \"jujuuser\" entry ID: %w", err)
+	}
+
+	err = recordJujuUserChange(ctx, tx, "create", object.Username)
+	if err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// CreateJujuUserComplete adds a new JujuUser to the database like CreateJujuUser, along with its initial roles
+// and labels. The roles are all validated before anything is written, and any error is returned so that the
+// enclosing transaction is rolled back without leaving the JujuUser behind.
+func CreateJujuUserComplete(ctx context.Context, tx *sql.Tx, object JujuUser, roles []string, labels map[string]string) (int64, error) {
+	for _, role := range roles {
+		err := validateJujuUserRole(role)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	id, err := CreateJujuUser(ctx, tx, object)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(roles) > 0 {
+		stmt, err := prepareStmt(ctx, tx, jujuUserRoleCreate)
+		if err != nil {
+			return -1, fmt.Errorf("Failed to get \"jujuUserRoleCreate\" prepared statement: %w", err)
+		}
+
+		for _, role := range roles {
+			_, err = stmt.ExecContext(ctx, id, role)
+			if err != nil {
+				return -1, fmt.Errorf("Failed to create \"jujuuser_roles\" entry: %w", err)
+			}
+		}
+	}
+
+	if len(labels) > 0 {
+		stmt, err := prepareStmt(ctx, tx, jujuUserLabelSet)
+		if err != nil {
+			return -1, fmt.Errorf("Failed to get \"jujuUserLabelSet\" prepared statement: %w", err)
+		}
+
+		for key, value := range labels {
+			_, err = stmt.ExecContext(ctx, id, key, value)
+			if err != nil {
+				return -1, fmt.Errorf("Failed to set \"jujuuser_labels\" entry: %w", err)
+			}
+		}
+	}
+
+	return id, nil
+}
+
+// DeleteJujuUserOptions tunes DeleteJujuUserWithOptions.
+type DeleteJujuUserOptions struct {
+	// Force deletes the JujuUser even if it is the last one holding the admin role.
+	Force bool
+
+	// AllControllers deletes the username under every controller it exists in, rather than failing when it exists
+	// under more than one.
+	AllControllers bool
+}
+
+// DeleteJujuUser deletes the JujuUser matching the given key parameters.
+// The last JujuUser holding the admin role is not deleted, a conflict error is returned instead.
+// The entry is removed along with its labels and roles, leaving no tombstone behind to purge later.
+func DeleteJujuUser(ctx context.Context, tx *sql.Tx, username string) error {
+	return DeleteJujuUserWithOptions(ctx, tx, username, DeleteJujuUserOptions{})
+}
+
+// DeleteJujuUserWithOptions deletes the JujuUser matching the given key parameters like DeleteJujuUser.
+func DeleteJujuUserWithOptions(ctx context.Context, tx *sql.Tx, username string, opts DeleteJujuUserOptions) error {
+	ctx, span := startJujuUserSpan(ctx, "delete", username)
+	err := deleteJujuUserWithOptions(ctx, tx, username, opts)
+	span.End(err)
+
+	return err
+}
+
+// deleteJujuUserWithOptions is DeleteJujuUserWithOptions without tracing.
+func deleteJujuUserWithOptions(ctx context.Context, tx *sql.Tx, username string, opts DeleteJujuUserOptions) error {
+	// Make sure the username only matches a single entry before deleting anything.
+	_, err := GetJujuUserID(ctx, tx, username)
+	if err != nil && !(opts.AllControllers && api.StatusErrorCheck(err, http.StatusConflict)) {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+		}
+
+		return err
+	}
+
+	if !opts.Force {
+		err := checkNotLastJujuUserAdmin(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteByUsername)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserDeleteByUsername\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, username)
+	if err != nil {
+		return fmt.Errorf("Delete \"jujuuser\" entry %q: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows deleting JujuUser %q: %w", username, err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	} else if n > 1 && !opts.AllControllers {
+		return fmt.Errorf("Query deleted %d JujuUser rows instead of 1 for %q", n, username)
+	}
+
+	return recordJujuUserChange(ctx, tx, "delete", username)
+}
+
+// Outcomes of deleting a JujuUser reported by DeleteJujuUsersDetailed.
+const (
+	JujuUserDeleted = "deleted"
+	JujuUserAbsent  = "absent"
+)
+
+// DeleteJujuUsersDetailed deletes the JujuUsers with the given usernames and maps every username to its outcome,
+// JujuUserDeleted or JujuUserAbsent if there was no such user. Any other failure aborts the whole batch.
+func DeleteJujuUsersDetailed(ctx context.Context, tx *sql.Tx, usernames []string) (map[string]string, error) {
+	err := CheckJujuUserBatchSize(len(usernames))
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make(map[string]string, len(usernames))
+	for _, username := range usernames {
+		_, ok := outcomes[username]
+		if ok {
+			continue
+		}
+
+		err := DeleteJujuUser(ctx, tx, username)
+		if err != nil {
+			if !api.StatusErrorCheck(err, http.StatusNotFound) {
+				return nil, err
+			}
+
+			outcomes[username] = JujuUserAbsent
+			continue
+		}
+
+		outcomes[username] = JujuUserDeleted
+	}
+
+	return outcomes, nil
+}
+
+// DeleteJujuUsersByPrefix deletes all JujuUsers whose username starts with prefix, such as the users of a
+// decommissioned tenant, and returns how many usernames were deleted, under every controller they exist in.
+// As a safety check against matching more users than intended, nothing is deleted and a conflict error is
+// returned unless exactly expectedCount usernames match.
+// Prefixes follow the username collation, so they ignore case with case insensitive usernames.
+func DeleteJujuUsersByPrefix(ctx context.Context, tx *sql.Tx, prefix string, expectedCount int) (int, error) {
+	if prefix == "" {
+		return 0, api.StatusErrorf(http.StatusBadRequest, "Cannot delete juju users by an empty prefix")
+	}
+
+	collation, err := UsernameCollation(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	// LIKE ignores ASCII case whatever the collation, and GLOB never does. DISTINCT follows the column collation.
+	queryStr := `SELECT DISTINCT jujuuser.username FROM jujuuser WHERE jujuuser.username GLOB ? ORDER BY jujuuser.username`
+	pattern := strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(prefix) + "*"
+	if collation == UsernameCollationNoCase {
+		queryStr = `SELECT DISTINCT jujuuser.username FROM jujuuser WHERE jujuuser.username LIKE ? ESCAPE '\' ORDER BY jujuuser.username`
+		pattern = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+	}
+
+	matches, err := query.SelectStrings(ctx, tx, queryStr, pattern)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	if len(matches) != expectedCount {
+		return 0, api.StatusErrorf(http.StatusConflict, "Prefix %q matches %d juju users, expected %d", prefix, len(matches), expectedCount)
+	}
+
+	err = CheckJujuUserBatchSize(len(matches))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, username := range matches {
+		err := DeleteJujuUserWithOptions(ctx, tx, username, DeleteJujuUserOptions{AllControllers: true})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(matches), nil
+}
+
+// LockJujuUser gives tx the write lock before it reads the JujuUser with the given username, the dqlite
+// equivalent of SELECT ... FOR UPDATE.
+// Transactions start deferred and only take the write lock on their first write, so two read-modify-write
+// transactions could otherwise both read the same row before either writes. Once locked, concurrent writers
+// wait for tx to finish and read what it committed.
+func LockJujuUser(ctx context.Context, tx *sql.Tx, username string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserLock)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserLock\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, username)
+	if err != nil {
+		return fmt.Errorf("Failed to lock \"jujuuser\" entry %q: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows locking JujuUser %q: %w", username, err)
+	}
+
+	if n > 1 {
+		return ambiguousJujuUsernameError(username)
+	}
+
+	return nil
+}
+
+// GetJujuUsersForUpdate returns all JujuUsers like GetJujuUsers, after giving tx the write lock. It is meant
+// for reconcile loops that read everything, compute a diff and write it back within tx.
+// dqlite has no row locks, the whole database is locked instead: other transactions can still read, but any
+// other transaction trying to write, including a concurrent GetJujuUsersForUpdate, blocks until tx commits or
+// rolls back and then sees its changes. Keep such transactions short.
+func GetJujuUsersForUpdate(ctx context.Context, tx *sql.Tx) ([]JujuUser, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserTableLock)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserTableLock\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock \"jujuuser\" table: %w", err)
+	}
+
+	return GetJujuUsers(ctx, tx)
+}
+
+// UpdateJujuUser updates the JujuUser matching the given key parameters.
+// A zero ControllerID keeps the controller of the entry.
+func UpdateJujuUser(ctx context.Context, tx *sql.Tx, username string, object JujuUser) error {
+	ctx, span := startJujuUserSpan(ctx, "update", username)
+	err := updateJujuUser(ctx, tx, username, object)
+	span.End(err)
+
+	return err
+}
+
+// updateJujuUser is UpdateJujuUser without tracing.
+func updateJujuUser(ctx context.Context, tx *sql.Tx, username string, object JujuUser) error {
+	if object.Username != username {
+		err := CheckJujuUserRouteName(object.Username)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := LockJujuUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	current, err := getJujuUserWithRepair(ctx, tx, username, false)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound, http.StatusConflict) {
+			return err
+		}
+
+		return fmt.Errorf("Failed to get JujuUser %q: %w", username, err)
+	}
+
+	id := current.ID
+
+	// A zero ControllerID keeps the entry in its controller.
+	if object.ControllerID == 0 {
+		object.ControllerID = current.ControllerID
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserUpdate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserUpdate\" prepared statement: %w", err)
+	}
+
+	token, version, err := sealToken(object.Token)
+	if err != nil {
+		return err
+	}
+
+	result, err := stmt.ExecContext(ctx, object.Username, token, object.ControllerID, time.Now().UTC(), version, nullString(object.DisplayName), nullTokenMeta(object.TokenMeta), TokenFingerprint(object.Token), id)
+	if err != nil {
+		return fmt.Errorf("Update \"jujuuser\" entry %q failed: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows updating JujuUser %q: %w", username, err)
+	}
+
+	if n == 0 {
+		// Some backends report no affected rows when the values are unchanged, that is not a failure
+		// as long as the entry is still there.
+		exists, err := JujuUserExists(ctx, tx, object.Username)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+		}
+	} else if n != 1 {
+		return fmt.Errorf("Query updated %d rows instead of 1 for %q", n, username)
+	}
+
+	return recordJujuUserChange(ctx, tx, "update", object.Username)
+}
+
+// CompareAndSetJujuUserToken replaces the token of the JujuUser with newToken only if it currently equals oldToken.
+// It returns whether the token was swapped.
+func CompareAndSetJujuUserToken(ctx context.Context, tx *sql.Tx, username string, oldToken string, newToken string) (bool, error) {
+	err := LockJujuUser(ctx, tx, username)
+	if err != nil {
+		return false, err
+	}
+
+	// Stored tokens may be encrypted with a random nonce, so compare the plain text within the transaction.
+	object, err := GetJujuUser(ctx, tx, username)
+	if err != nil {
+		return false, err
+	}
+
+	if object.Token != oldToken {
+		return false, nil
+	}
+
+	err = setJujuUserToken(ctx, tx, object, newToken)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// setJujuUserToken stores token for the given JujuUser entry and records the change.
+func setJujuUserToken(ctx context.Context, tx *sql.Tx, object *JujuUser, newToken string) error {
+	token, version, err := sealToken(newToken)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokenUpdateByID)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserTokenUpdateByID\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, token, version, time.Now().UTC(), TokenFingerprint(newToken), object.ID)
+	if err != nil {
+		return fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+	}
+
+	return recordJujuUserChange(ctx, tx, "update", object.Username)
+}
+
+// skipNoOpTokenUpdates is whether UpdateJujuUserTokens leaves alone the JujuUsers already having the new token.
+var skipNoOpTokenUpdates = true
+var skipNoOpTokenUpdatesMu sync.RWMutex
+
+// SetSkipNoOpTokenUpdates sets whether UpdateJujuUserTokens skips the write for JujuUsers already having the new
+// token, which spares the row writes and their history and outbox entries when reconcile loops set the same token
+// over again.
+// Skipping is enabled by default.
+func SetSkipNoOpTokenUpdates(skip bool) {
+	skipNoOpTokenUpdatesMu.Lock()
+	defer skipNoOpTokenUpdatesMu.Unlock()
+
+	skipNoOpTokenUpdates = skip
+}
+
+// UpdateJujuUserTokens sets the token of every username in updates to its mapped value.
+// If a username does not exist the whole batch fails with a not found error, unless skipMissing is set
+// in which case it is ignored. It returns the number of updated users, which includes the users already having
+// the requested token and so not written to if SetSkipNoOpTokenUpdates is enabled.
+func UpdateJujuUserTokens(ctx context.Context, tx *sql.Tx, updates map[string]string, skipMissing bool) (int, error) {
+	err := CheckJujuUserBatchSize(len(updates))
+	if err != nil {
+		return 0, err
+	}
+
+	usernames := make([]string, 0, len(updates))
+	for username := range updates {
+		usernames = append(usernames, username)
+	}
+
+	// Apply the updates in a stable order.
+	sort.Strings(usernames)
+
+	skipNoOpTokenUpdatesMu.RLock()
+	skipNoOp := skipNoOpTokenUpdates
+	skipNoOpTokenUpdatesMu.RUnlock()
+
+	updated := 0
+	for _, username := range usernames {
+		// Take the lock before comparing the token, so that it cannot change between the comparison and the write.
+		err := LockJujuUser(ctx, tx, username)
+		if err != nil {
+			return 0, err
+		}
+
+		object, err := GetJujuUser(ctx, tx, username)
+		if err != nil {
+			if skipMissing && api.StatusErrorCheck(err, http.StatusNotFound) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		if skipNoOp && object.TokenSet && object.Token == updates[username] {
+			updated++
+			continue
+		}
+
+		err = setJujuUserToken(ctx, tx, object, updates[username])
+		if err != nil {
+			return 0, err
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+// RotateAllJujuUserTokens replaces the token of every JujuUser with one produced by generator.
+// It returns the number of rotated users.
+func RotateAllJujuUserTokens(ctx context.Context, tx *sql.Tx, generator func(username string) (string, error)) (int, error) {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return rotateJujuUserTokens(ctx, tx, objects, generator)
+}
+
+// rotateJujuUserTokens replaces the token of each of the given JujuUsers with one produced by generator.
+func rotateJujuUserTokens(ctx context.Context, tx *sql.Tx, objects []JujuUser, generator func(username string) (string, error)) (int, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserUpdate)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserUpdate\" prepared statement: %w", err)
+	}
+
+	for _, object := range objects {
+		token, err := generator(object.Username)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to generate token for juju user %q: %w", object.Username, err)
+		}
+
+		fingerprint := TokenFingerprint(token)
+		token, version, err := sealToken(token)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = stmt.ExecContext(ctx, object.Username, token, jujuUserControllerID(object.ControllerID), time.Now().UTC(), version, nullString(object.DisplayName), nullTokenMeta(object.TokenMeta), fingerprint, object.ID)
+		if err != nil {
+			return 0, fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+		}
+
+		err = recordJujuUserChange(ctx, tx, "rotate", object.Username)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(objects), nil
 }
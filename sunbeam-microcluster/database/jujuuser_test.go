@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+func TestCreateJujuUserUniquePerController(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-2", ControllerID: 2})
+
+	err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "alice", Token: "token-3", ControllerID: DefaultJujuControllerID})
+		return err
+	})
+	assertStatus(t, err, http.StatusConflict)
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		for controllerID, want := range map[int64]string{DefaultJujuControllerID: "token-1", 2: "token-2"} {
+			user, err := GetJujuUserInController(ctx, tx, controllerID, "alice")
+			if err != nil {
+				t.Fatalf("Failed to get juju user of controller %d: %v", controllerID, err)
+			}
+
+			if user.Token != want {
+				t.Errorf("Controller %d: expected token %q, got %q", controllerID, want, user.Token)
+			}
+		}
+
+		return nil
+	})
+}
+
+func TestJujuUsernameLookupsAmbiguousAcrossControllers(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-2", ControllerID: 2})
+
+	lookups := map[string]func(ctx context.Context, tx *sql.Tx) error{
+		"GetJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := GetJujuUser(ctx, tx, "alice")
+			return err
+		},
+		"GetJujuUserID": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := GetJujuUserID(ctx, tx, "alice")
+			return err
+		},
+		"GetJujuUserToken": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := GetJujuUserToken(ctx, tx, "alice")
+			return err
+		},
+		"LockJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			return LockJujuUser(ctx, tx, "alice")
+		},
+		"UpdateJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			return UpdateJujuUser(ctx, tx, "alice", JujuUser{Username: "alice", Token: "token-3"})
+		},
+		"DeleteJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			return DeleteJujuUser(ctx, tx, "alice")
+		},
+	}
+
+	for name, lookup := range lookups {
+		t.Run(name, func(t *testing.T) {
+			err := testTransaction(db)(context.Background(), lookup)
+			assertStatus(t, err, http.StatusConflict)
+		})
+	}
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		exists, err := JujuUserExists(ctx, tx, "alice")
+		if err != nil || !exists {
+			t.Fatalf("Expected the juju user to exist, got %v, %v", exists, err)
+		}
+
+		users, err := GetJujuUsers(ctx, tx, JujuUserByUsername("alice"))
+		if err != nil {
+			return err
+		}
+
+		if len(users) != 2 {
+			t.Fatalf("Expected both juju users to be left alone, got %d", len(users))
+		}
+
+		return nil
+	})
+}
+
+func TestUpdateJujuUserZeroControllerID(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1", ControllerID: 2})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return UpdateJujuUser(ctx, tx, "alice", JujuUser{Username: "alice", Token: "token-2"})
+	})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		user, err := GetJujuUser(ctx, tx, "alice")
+		if err != nil {
+			return err
+		}
+
+		if user.ControllerID != 2 || user.Token != "token-2" {
+			t.Fatalf("Expected token %q in controller 2, got %q in controller %d", "token-2", user.Token, user.ControllerID)
+		}
+
+		return nil
+	})
+}
+
+func TestControllerScopedWritesWithSharedUsername(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-2", ControllerID: 2})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		swapped, err := CompareAndSetJujuUserTokenInController(ctx, tx, 2, "alice", "token-2", "token-3")
+		if err != nil || !swapped {
+			t.Fatalf("Expected the token of controller 2 to be swapped, got %v, %v", swapped, err)
+		}
+
+		_, err = UpsertJujuUser(ctx, tx, JujuUser{Username: "alice", Token: "token-4", ControllerID: DefaultJujuControllerID})
+		if err != nil {
+			t.Fatalf("Failed to upsert the juju user of the default controller: %v", err)
+		}
+
+		return nil
+	})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		for controllerID, want := range map[int64]string{DefaultJujuControllerID: "token-4", 2: "token-3"} {
+			token, err := GetJujuUserTokenInController(ctx, tx, controllerID, "alice")
+			if err != nil {
+				return err
+			}
+
+			if token != want {
+				t.Errorf("Controller %d: expected token %q, got %q", controllerID, want, token)
+			}
+		}
+
+		return nil
+	})
+}
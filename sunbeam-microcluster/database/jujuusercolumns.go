@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// jujuUserUnmappedColumns are the jujuuser columns deliberately left out of jujuUserColumns, as dedicated
+// statements read and write them.
+var jujuUserUnmappedColumns = map[string]bool{
+	"last_used_at":       true,
+	"needs_provisioning": true,
+}
+
+// jujuUserSelectedColumns returns the names of the columns selected by jujuUserColumns.
+func jujuUserSelectedColumns() []string {
+	columns := strings.Split(jujuUserColumns(), ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimPrefix(strings.TrimSpace(column), "jujuuser.")
+	}
+
+	return columns
+}
+
+// VerifyJujuUserColumns checks that the columns selected by jujuUserColumns, which the prepared statements of
+// JujuUsers are built from, match the live jujuuser table. Every selected column must exist, and every column
+// of the table must be selected unless it is one of jujuUserUnmappedColumns. It is meant to fail the startup
+// with a descriptive error should the schema and the statements drift apart, rather than the first request.
+func VerifyJujuUserColumns(ctx context.Context, tx *sql.Tx) error {
+	live, err := getTableColumns(ctx, tx, "jujuuser")
+	if err != nil {
+		return err
+	}
+
+	if len(live) == 0 {
+		return fmt.Errorf("Table \"jujuuser\" is missing")
+	}
+
+	selected := jujuUserSelectedColumns()
+
+	present := make(map[string]bool, len(live))
+	for _, column := range live {
+		present[column] = true
+	}
+
+	mapped := make(map[string]bool, len(selected))
+	missing := []string{}
+	for _, column := range selected {
+		mapped[column] = true
+		if !present[column] {
+			missing = append(missing, column)
+		}
+	}
+
+	unmapped := []string{}
+	for _, column := range live {
+		if !mapped[column] && !jujuUserUnmappedColumns[column] {
+			unmapped = append(unmapped, column)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Table \"jujuuser\" is missing columns %s selected by the juju user statements", strings.Join(missing, ", "))
+	}
+
+	if len(unmapped) > 0 {
+		return fmt.Errorf("Table \"jujuuser\" has columns %s unknown to the juju user statements", strings.Join(unmapped, ", "))
+	}
+
+	return nil
+}
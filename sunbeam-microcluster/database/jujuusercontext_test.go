@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowJujuUserWrites makes every write of a jujuuser row run a query taking far longer than any test, so
+// that a write is still in flight when its context ends.
+func slowJujuUserWrites(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		stmts := []string{
+			"CREATE TABLE slow (n INTEGER)",
+			"WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 1000) INSERT INTO slow SELECT n FROM seq",
+		}
+
+		for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+			stmts = append(stmts, fmt.Sprintf("CREATE TRIGGER slow_%s AFTER %s ON jujuuser BEGIN SELECT count(*) FROM slow a, slow b, slow c; END", strings.ToLower(event), event))
+		}
+
+		for _, stmt := range stmts {
+			_, err := tx.ExecContext(ctx, stmt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func TestJujuUserWritesCancelled(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		write func(ctx context.Context, tx *sql.Tx) error
+	}{
+		{
+			name: "create",
+			write: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "bob", Token: "token"})
+				return err
+			},
+		},
+		{
+			name: "update",
+			write: func(ctx context.Context, tx *sql.Tx) error {
+				return UpdateJujuUser(ctx, tx, "alice", JujuUser{Username: "alice", Token: "new-token"})
+			},
+		},
+		{
+			name: "delete",
+			write: func(ctx context.Context, tx *sql.Tx) error {
+				return DeleteJujuUser(ctx, tx, "alice")
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+			slowJujuUserWrites(t, db)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := testTransaction(db)(ctx, test.write)
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected the %s to fail as cancelled, got %v", test.name, err)
+			}
+
+			if elapsed > 2*time.Second {
+				t.Fatalf("Expected the %s to return promptly once cancelled, it took %v", test.name, elapsed)
+			}
+
+			var users []JujuUser
+			mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+				users, err = GetJujuUsers(ctx, tx)
+				return err
+			})
+
+			if len(users) != 1 || users[0].Username != "alice" || users[0].Token != "token" {
+				t.Fatalf("Expected the cancelled %s to be rolled back, got %+v", test.name, users)
+			}
+		})
+	}
+}
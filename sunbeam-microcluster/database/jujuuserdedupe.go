@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserLabelsMerge = cluster.RegisterStmt(`
+INSERT OR IGNORE INTO jujuuser_labels (jujuuser_id, key, value)
+  SELECT ?, jujuuser_labels.key, jujuuser_labels.value FROM jujuuser_labels WHERE jujuuser_labels.jujuuser_id = ?
+`)
+
+var jujuUserRolesMerge = cluster.RegisterStmt(`
+INSERT OR IGNORE INTO jujuuser_roles (jujuuser_id, role)
+  SELECT ?, jujuuser_roles.role FROM jujuuser_roles WHERE jujuuser_roles.jujuuser_id = ?
+`)
+
+// RepairDuplicateJujuUsernames removes the JujuUsers whose username only differs by case from another one in
+// the same controller, as can be left over from before usernames were made case insensitive. Of each group of
+// duplicates the most recently updated entry is kept, and the labels and roles of the others are merged into
+// it unless it already has a label with the same key. It returns the sorted usernames of the removed entries.
+func RepairDuplicateJujuUsernames(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]JujuUser{}
+	for _, object := range objects {
+		key := fmt.Sprintf("%d/%s", object.ControllerID, strings.ToLower(object.Username))
+		groups[key] = append(groups[key], object)
+	}
+
+	stmts := map[int]*sql.Stmt{}
+	for _, code := range []int{jujuUserLabelsMerge, jujuUserRolesMerge, jujuUserDeleteByID} {
+		stmts[code], err = prepareStmt(ctx, tx, code)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get \"jujuuser\" repair prepared statement: %w", err)
+		}
+	}
+
+	removed := []string{}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		keep := 0
+		for i, object := range group {
+			if object.UpdatedAt.After(group[keep].UpdatedAt) || (object.UpdatedAt.Equal(group[keep].UpdatedAt) && object.ID > group[keep].ID) {
+				keep = i
+			}
+		}
+
+		for i, object := range group {
+			if i == keep {
+				continue
+			}
+
+			for _, code := range []int{jujuUserLabelsMerge, jujuUserRolesMerge} {
+				_, err = stmts[code].ExecContext(ctx, group[keep].ID, object.ID)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to merge \"jujuuser\" entry %q into %q: %w", object.Username, group[keep].Username, err)
+				}
+			}
+
+			_, err = stmts[jujuUserDeleteByID].ExecContext(ctx, object.ID)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to delete duplicate \"jujuuser\" entry %q: %w", object.Username, err)
+			}
+
+			err = recordJujuUserChange(ctx, tx, "delete", object.Username)
+			if err != nil {
+				return nil, err
+			}
+
+			removed = append(removed, object.Username)
+		}
+	}
+
+	sort.Strings(removed)
+
+	return removed, nil
+}
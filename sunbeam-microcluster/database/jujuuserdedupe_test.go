@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepairDuplicateJujuUsernames(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "Admin", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "admin", Token: "token-2"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "Carol", Token: "token-3"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "carol", Token: "token-4", ControllerID: 2})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		// The lowercase entry is the most recently updated one.
+		_, err := tx.ExecContext(ctx, "UPDATE jujuuser SET updated_at = ? WHERE username = 'Admin'", time.Now().UTC().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+
+		for _, label := range []struct{ username, key, value string }{
+			{username: "Admin", key: "team", value: "a"},
+			{username: "Admin", key: "env", value: "prod"},
+			{username: "admin", key: "team", value: "b"},
+		} {
+			err := SetJujuUserLabel(ctx, tx, label.username, label.key, label.value)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, role := range []struct{ username, role string }{
+			{username: "Admin", role: JujuUserRoleAdmin},
+			{username: "admin", role: JujuUserRoleViewer},
+		} {
+			err := AddJujuUserRole(ctx, tx, role.username, role.role)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		removed, err := RepairDuplicateJujuUsernames(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(removed, []string{"Admin"}) {
+			t.Errorf("Expected only %q to be removed, got %q", "Admin", removed)
+		}
+
+		return nil
+	})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		users, err := GetJujuUsers(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		usernames := []string{}
+		for _, user := range users {
+			usernames = append(usernames, user.Username)
+		}
+
+		// Usernames under different controllers are not duplicates.
+		if !reflect.DeepEqual(usernames, []string{"Carol", "admin", "carol"}) {
+			t.Errorf("Unexpected juju users after the repair: %q", usernames)
+		}
+
+		labels, err := GetJujuUserLabels(ctx, tx, "admin")
+		if err != nil {
+			return err
+		}
+
+		// The label of the kept entry wins over the one of the removed entry with the same key.
+		if !reflect.DeepEqual(labels, map[string]string{"team": "b", "env": "prod"}) {
+			t.Errorf("Unexpected merged labels %v", labels)
+		}
+
+		roles, err := GetJujuUserRoles(ctx, tx, "admin")
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(roles, []string{JujuUserRoleAdmin, JujuUserRoleViewer}) {
+			t.Errorf("Unexpected merged roles %q", roles)
+		}
+
+		return nil
+	})
+}
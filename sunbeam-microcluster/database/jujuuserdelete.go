@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// JujuUserDeleteTTL is how long a prepared JujuUser delete can be committed for.
+const JujuUserDeleteTTL = 5 * time.Minute
+
+var jujuUserServicesByUsername = cluster.RegisterStmt(`
+SELECT nodes.role FROM nodes
+  WHERE nodes.name = ?
+`)
+
+var jujuUserDeleteIntentCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_delete_intents (token, username, services, expires_at)
+  VALUES (?, ?, ?, ?)
+`)
+
+var jujuUserDeleteIntentByToken = cluster.RegisterStmt(`
+SELECT jujuuser_delete_intents.username, jujuuser_delete_intents.services, jujuuser_delete_intents.expires_at
+  FROM jujuuser_delete_intents
+  WHERE jujuuser_delete_intents.token = ?
+`)
+
+var jujuUserDeleteIntentDelete = cluster.RegisterStmt(`
+DELETE FROM jujuuser_delete_intents WHERE token = ?
+`)
+
+var jujuUserDeleteIntentsExpiredDelete = cluster.RegisterStmt(`
+DELETE FROM jujuuser_delete_intents WHERE expires_at < ?
+`)
+
+// GetJujuUserServices returns the services of the node the JujuUser with the given username is registered for.
+// Juju users are registered under the name of their node, a user without a node has no services.
+func GetJujuUserServices(ctx context.Context, tx *sql.Tx, username string) ([]string, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserServicesByUsername)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserServicesByUsername\" prepared statement: %w", err)
+	}
+
+	var role sql.NullString
+	err = stmt.QueryRowContext(ctx, username).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to get \"nodes\" role: %w", err)
+	}
+
+	return parseNodeServices(role)
+}
+
+// parseNodeServices returns the services listed in the role of a node, a node without role has no services.
+func parseNodeServices(role sql.NullString) ([]string, error) {
+	services := []string{}
+	if role.String != "" {
+		err := json.Unmarshal([]byte(role.String), &services)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal role: %w", err)
+		}
+	}
+
+	return services, nil
+}
+
+// PrepareDeleteJujuUser records the intent to delete the JujuUser with the given username and returns the
+// confirmation token to pass to CommitDeleteJujuUser within JujuUserDeleteTTL, along with the services that
+// currently depend on the user.
+func PrepareDeleteJujuUser(ctx context.Context, tx *sql.Tx, username string) (string, []string, error) {
+	_, err := GetJujuUser(ctx, tx, username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	services, err := GetJujuUserServices(ctx, tx, username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to generate confirmation token: %w", err)
+	}
+
+	token := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(services)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+
+	// Drop the intents nobody committed.
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteIntentsExpiredDelete)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to get \"jujuUserDeleteIntentsExpiredDelete\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, now)
+	if err != nil {
+		return "", nil, fmt.Errorf("Delete \"jujuuser_delete_intents\": %w", err)
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserDeleteIntentCreate)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to get \"jujuUserDeleteIntentCreate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, token, username, string(data), now.Add(JujuUserDeleteTTL))
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to create \"jujuuser_delete_intents\" entry: %w", err)
+	}
+
+	return token, services, nil
+}
+
+// PurgeExpiredJujuUserDeleteIntents removes the delete intents nobody committed within JujuUserDeleteTTL and
+// returns how many it removed.
+func PurgeExpiredJujuUserDeleteIntents(ctx context.Context, tx *sql.Tx) (int64, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteIntentsExpiredDelete)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserDeleteIntentsExpiredDelete\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("Delete \"jujuuser_delete_intents\": %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Fetch affected rows: %w", err)
+	}
+
+	return n, nil
+}
+
+// CommitDeleteJujuUser deletes the JujuUser whose delete was prepared with the given confirmation token.
+// The delete is refused if the token expired or if services started depending on the user since it was prepared.
+// The token can only be used once, unless the delete is refused, expired tokens staying refused until purged.
+func CommitDeleteJujuUser(ctx context.Context, tx *sql.Tx, token string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteIntentByToken)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserDeleteIntentByToken\" prepared statement: %w", err)
+	}
+
+	var username, data string
+	var expiresAt time.Time
+	err = stmt.QueryRowContext(ctx, token).Scan(&username, &data, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.StatusErrorf(http.StatusNotFound, "Unknown juju user delete confirmation token")
+	} else if err != nil {
+		return fmt.Errorf("Failed to get \"jujuuser_delete_intents\" entry: %w", err)
+	}
+
+	// The error rolls tx back, so the expired intent is left for PurgeExpiredJujuUserDeleteIntents.
+	if time.Now().UTC().After(expiresAt) {
+		return api.StatusErrorf(http.StatusGone, "Delete confirmation token for juju user %q expired", username)
+	}
+
+	prepared := []string{}
+	err = json.Unmarshal([]byte(data), &prepared)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal services: %w", err)
+	}
+
+	services, err := GetJujuUserServices(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, service := range prepared {
+		known[service] = true
+	}
+
+	added := []string{}
+	for _, service := range services {
+		if !known[service] {
+			added = append(added, service)
+		}
+	}
+
+	if len(added) > 0 {
+		return api.StatusErrorf(http.StatusConflict, "Juju user %q gained dependent services since the delete was prepared: %s", username, strings.Join(added, ", "))
+	}
+
+	err = deleteJujuUserDeleteIntent(ctx, tx, token)
+	if err != nil {
+		return err
+	}
+
+	return DeleteJujuUser(ctx, tx, username)
+}
+
+// deleteJujuUserDeleteIntent removes the delete intent with the given token.
+func deleteJujuUserDeleteIntent(ctx context.Context, tx *sql.Tx, token string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserDeleteIntentDelete)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserDeleteIntentDelete\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, token)
+	if err != nil {
+		return fmt.Errorf("Delete \"jujuuser_delete_intents\": %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// mustCreateNode adds the node name with the given JSON role and fails the test on error. The cluster member
+// table of microcluster is stood in for by a minimal one.
+func mustCreateNode(t *testing.T, db *sql.DB, name string, role string) {
+	t.Helper()
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS internal_cluster_members (id INTEGER PRIMARY KEY, name TEXT)")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO internal_cluster_members (id, name) VALUES (1, 'member-1')")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO nodes (member_id, name, role) VALUES (1, ?, ?)", name, role)
+		return err
+	})
+}
+
+// prepareDelete prepares the delete of the juju user username and returns its confirmation token.
+func prepareDelete(t *testing.T, db *sql.DB, username string) string {
+	t.Helper()
+
+	var token string
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		token, _, err = PrepareDeleteJujuUser(ctx, tx, username)
+		return err
+	})
+
+	return token
+}
+
+// commitDelete commits the delete with the given confirmation token in its own transaction.
+func commitDelete(db *sql.DB, token string) error {
+	return testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		return CommitDeleteJujuUser(ctx, tx, token)
+	})
+}
+
+// jujuUserExists returns whether the juju user username exists.
+func jujuUserExists(t *testing.T, db *sql.DB, username string) bool {
+	t.Helper()
+
+	var exists bool
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		exists, err = JujuUserExists(ctx, tx, username)
+		return err
+	})
+
+	return exists
+}
+
+func TestCommitDeleteJujuUser(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "node-1", Token: "token-1"})
+	mustCreateNode(t, db, "node-1", `["compute"]`)
+
+	token := prepareDelete(t, db, "node-1")
+
+	err := commitDelete(db, token)
+	if err != nil {
+		t.Fatalf("Failed to commit the delete: %v", err)
+	}
+
+	if jujuUserExists(t, db, "node-1") {
+		t.Fatalf("Expected the juju user to be deleted")
+	}
+
+	err = commitDelete(db, token)
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestCommitDeleteJujuUserNewDependency(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "node-1", Token: "token-1"})
+
+	token := prepareDelete(t, db, "node-1")
+	mustCreateNode(t, db, "node-1", `["storage"]`)
+
+	err := commitDelete(db, token)
+	assertStatus(t, err, http.StatusConflict)
+
+	if !jujuUserExists(t, db, "node-1") {
+		t.Fatalf("Expected the juju user to be kept")
+	}
+}
+
+func TestCommitDeleteJujuUserExpired(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "node-1", Token: "token-1"})
+
+	token := prepareDelete(t, db, "node-1")
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE jujuuser_delete_intents SET expires_at = ?", time.Now().UTC().Add(-time.Minute))
+		return err
+	})
+
+	// The token stays expired rather than unknown until it is purged.
+	for i := 0; i < 2; i++ {
+		err := commitDelete(db, token)
+		assertStatus(t, err, http.StatusGone)
+	}
+
+	if !jujuUserExists(t, db, "node-1") {
+		t.Fatalf("Expected the juju user to be kept")
+	}
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		purged, err := PurgeExpiredJujuUserDeleteIntents(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if purged != 1 {
+			t.Errorf("Expected 1 purged intent, got %d", purged)
+		}
+
+		return nil
+	})
+
+	err := commitDelete(db, token)
+	assertStatus(t, err, http.StatusNotFound)
+}
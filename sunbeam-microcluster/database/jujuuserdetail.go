@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserObjectWithServicesByUsername = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s, nodes.role
+  FROM jujuuser
+  LEFT JOIN nodes ON nodes.name = jujuuser.username
+  WHERE ( jujuuser.username = ? )
+  ORDER BY jujuuser.id
+`, jujuUserColumns()))
+
+// JujuUserDetail is a JujuUser along with the services of the node it is registered for.
+type JujuUserDetail struct {
+	JujuUser
+	Services []string
+}
+
+// GetJujuUserWithServices returns the JujuUser with the given key along with its services, read in a single query.
+// A user whose node has no services, or which has no node, gets an empty list of services.
+func GetJujuUserWithServices(ctx context.Context, tx *sql.Tx, username string) (*JujuUserDetail, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectWithServicesByUsername)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectWithServicesByUsername\" prepared statement: %w", err)
+	}
+
+	details := []JujuUserDetail{}
+	dest := func(scan func(dest ...any) error) error {
+		var role sql.NullString
+		object, err := scanJujuUser(func(dest ...any) error {
+			return scan(append(dest, &role)...)
+		})
+		if err != nil {
+			return err
+		}
+
+		services, err := parseNodeServices(role)
+		if err != nil {
+			return err
+		}
+
+		details = append(details, JujuUserDetail{JujuUser: object, Services: services})
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch JujuUser %q from \"jujuuser\" table: %w", username, err)
+	}
+
+	switch len(details) {
+	case 0:
+		return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	case 1:
+		return &details[0], nil
+	}
+
+	for _, detail := range details {
+		if detail.ControllerID != details[0].ControllerID {
+			return nil, ambiguousJujuUsernameError(username)
+		}
+	}
+
+	return nil, api.StatusErrorf(http.StatusConflict, "More than one \"jujuuser\" entry matches username %q", username)
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// JujuUsersSnapshotVersion is the version of the format written by ExportJujuUsersSnapshot.
+// It must be bumped, and ImportJujuUsersSnapshot taught to read the previous versions, whenever the format changes.
+const JujuUsersSnapshotVersion = 1
+
+// JujuUsersSnapshot is the self-describing backup of the jujuuser table.
+type JujuUsersSnapshot struct {
+	Version    int                     `json:"version"`
+	ExportedAt time.Time               `json:"exported-at"`
+	Users      []JujuUserSnapshotEntry `json:"users"`
+}
+
+// JujuUserSnapshotEntry is one JujuUser of a JujuUsersSnapshot. Tokens are exported in plain text so that the
+// snapshot can be imported whatever encryption key the importing cluster uses.
+type JujuUserSnapshotEntry struct {
+	Username     string          `json:"username"`
+	Token        string          `json:"token"`
+	ControllerID int64           `json:"controller-id"`
+	DisplayName  string          `json:"display-name,omitempty"`
+	TokenMeta    json.RawMessage `json:"token-meta,omitempty"`
+	CreatedAt    time.Time       `json:"created-at"`
+	UpdatedAt    time.Time       `json:"updated-at"`
+}
+
+// ExportJujuUsersSnapshot returns the JSON encoded JujuUsersSnapshot of all JujuUsers.
+func ExportJujuUsersSnapshot(ctx context.Context, tx *sql.Tx) ([]byte, error) {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := JujuUsersSnapshot{
+		Version:    JujuUsersSnapshotVersion,
+		ExportedAt: time.Now().UTC(),
+		Users:      make([]JujuUserSnapshotEntry, 0, len(objects)),
+	}
+
+	for _, object := range objects {
+		// A snapshot missing tokens would wipe them once imported.
+		err = object.TokenErr()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to export juju user %q: %w", object.Username, err)
+		}
+
+		snapshot.Users = append(snapshot.Users, JujuUserSnapshotEntry{
+			Username:     object.Username,
+			Token:        object.Token,
+			ControllerID: object.ControllerID,
+			DisplayName:  object.DisplayName,
+			TokenMeta:    object.TokenMeta,
+			CreatedAt:    object.CreatedAt,
+			UpdatedAt:    object.UpdatedAt,
+		})
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode juju users snapshot: %w", err)
+	}
+
+	return data, nil
+}
+
+// ImportJujuUsersSnapshot restores the JujuUsers of a snapshot produced by ExportJujuUsersSnapshot, overwriting
+// the existing users with the same username. Snapshots of an unknown version, including ones written by a newer
+// release, are refused with a 400 StatusError. It returns the number of imported users.
+func ImportJujuUsersSnapshot(ctx context.Context, tx *sql.Tx, data []byte) (int, error) {
+	var snapshot JujuUsersSnapshot
+
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return 0, api.StatusErrorf(http.StatusBadRequest, "Invalid juju users snapshot: %v", err)
+	}
+
+	if snapshot.Version < 1 || snapshot.Version > JujuUsersSnapshotVersion {
+		return 0, api.StatusErrorf(http.StatusBadRequest, "Unsupported juju users snapshot version %d, expected at most %d", snapshot.Version, JujuUsersSnapshotVersion)
+	}
+
+	err = CheckJujuUserBatchSize(len(snapshot.Users))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range snapshot.Users {
+		if entry.Username == "" {
+			return 0, api.StatusErrorf(http.StatusBadRequest, "Juju users snapshot holds an entry without username")
+		}
+
+		_, err := UpsertJujuUser(ctx, tx, JujuUser{
+			Username:     entry.Username,
+			Token:        entry.Token,
+			ControllerID: entry.ControllerID,
+			DisplayName:  entry.DisplayName,
+			TokenMeta:    entry.TokenMeta,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("Failed to import juju user %q: %w", entry.Username, err)
+		}
+	}
+
+	return len(snapshot.Users), nil
+}
@@ -0,0 +1,33 @@
+package database
+
+// JujuUserByUsername returns a JujuUserFilter matching the JujuUsers with the given username.
+// The filter points to its own copy of username, so it is safe to build filters from a loop variable.
+func JujuUserByUsername(username string) JujuUserFilter {
+	return JujuUserFilter{Username: &username}
+}
+
+// JujuUserByDisplayName returns a JujuUserFilter matching the JujuUsers with the given display name.
+func JujuUserByDisplayName(displayName string) JujuUserFilter {
+	return JujuUserFilter{DisplayName: &displayName}
+}
+
+// JujuUserByControllerID returns a JujuUserFilter matching the JujuUsers of the given controller.
+func JujuUserByControllerID(controllerID int64) JujuUserFilter {
+	return JujuUserFilter{ControllerID: &controllerID}
+}
+
+// JujuUserWithToken returns a JujuUserFilter matching the JujuUsers having a token if hasToken is set, or
+// the ones without a token otherwise.
+func JujuUserWithToken(hasToken bool) JujuUserFilter {
+	return JujuUserFilter{HasToken: &hasToken}
+}
+
+// JujuUserByLabelKey returns a JujuUserFilter matching the JujuUsers carrying the label key, whatever its value.
+func JujuUserByLabelKey(key string) JujuUserFilter {
+	return JujuUserFilter{LabelKey: &key}
+}
+
+// JujuUserByLabel returns a JujuUserFilter matching the JujuUsers carrying the label key with the given value.
+func JujuUserByLabel(key string, value string) JujuUserFilter {
+	return JujuUserFilter{LabelKey: &key, LabelValue: &value}
+}
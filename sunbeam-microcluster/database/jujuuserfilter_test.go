@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// seedFilterJujuUsers adds the juju users the filter tests select from.
+func seedFilterJujuUsers(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	mustCreateJujuController(t, db, 2)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-a", DisplayName: "Alice"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "bob", Token: "token-b", DisplayName: "Bob", ControllerID: 2})
+	mustCreateJujuUser(t, db, JujuUser{Username: "carol", Token: "token-c"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "o'brien\"; DROP TABLE jujuuser; --", Token: "token-d"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "100%_x", Token: "token-e"})
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		err := SetJujuUserLabel(ctx, tx, "alice", "team", "a")
+		if err != nil {
+			return err
+		}
+
+		return SetJujuUserLabel(ctx, tx, "bob", "team", "b")
+	})
+}
+
+func TestGetJujuUsersFilters(t *testing.T) {
+	db := newTestDB(t)
+	seedFilterJujuUsers(t, db)
+
+	tests := []struct {
+		name    string
+		filters []JujuUserFilter
+		want    []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"100%_x", "alice", "bob", "carol", "o'brien\"; DROP TABLE jujuuser; --"},
+		},
+		{
+			name:    "single username",
+			filters: []JujuUserFilter{JujuUserByUsername("carol")},
+			want:    []string{"carol"},
+		},
+		{
+			name:    "usernames OR'ed",
+			filters: []JujuUserFilter{JujuUserByUsername("alice"), JujuUserByUsername("bob")},
+			want:    []string{"alice", "bob"},
+		},
+		{
+			name:    "fields AND'ed",
+			filters: []JujuUserFilter{{DisplayName: JujuUserByDisplayName("Alice").DisplayName, ControllerID: JujuUserByControllerID(2).ControllerID}},
+			want:    []string{},
+		},
+		{
+			name:    "controller and label",
+			filters: []JujuUserFilter{{ControllerID: JujuUserByControllerID(1).ControllerID, LabelKey: JujuUserByLabelKey("team").LabelKey}},
+			want:    []string{"alice"},
+		},
+		{
+			name: "arguments kept in filter order",
+			filters: []JujuUserFilter{
+				{ControllerID: JujuUserByControllerID(2).ControllerID, LabelKey: JujuUserByLabel("team", "b").LabelKey, LabelValue: JujuUserByLabel("team", "b").LabelValue},
+				JujuUserByDisplayName("Alice"),
+				{Username: JujuUserByUsername("carol").Username, HasToken: JujuUserWithToken(true).HasToken},
+			},
+			want: []string{"alice", "bob", "carol"},
+		},
+		{
+			name:    "label value needs the matching key",
+			filters: []JujuUserFilter{JujuUserByLabel("team", "a"), JujuUserByLabel("other", "b")},
+			want:    []string{"alice"},
+		},
+		{
+			name:    "SQL metacharacters are bound as values",
+			filters: []JujuUserFilter{JujuUserByUsername("o'brien\"; DROP TABLE jujuuser; --"), JujuUserByUsername("100%_x")},
+			want:    []string{"100%_x", "o'brien\"; DROP TABLE jujuuser; --"},
+		},
+		{
+			name:    "LIKE wildcards match literally",
+			filters: []JujuUserFilter{JujuUserByUsername("%"), JujuUserByUsername("_lice")},
+			want:    []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+				users, err := GetJujuUsers(ctx, tx, test.filters...)
+				if err != nil {
+					return err
+				}
+
+				got := []string{}
+				for _, user := range users {
+					got = append(got, user.Username)
+				}
+
+				if !reflect.DeepEqual(got, test.want) {
+					t.Errorf("Expected %q, got %q", test.want, got)
+				}
+
+				return nil
+			})
+		})
+	}
+}
+
+func TestGetJujuUsersInvalidFilters(t *testing.T) {
+	db := newTestDB(t)
+	value := "a"
+
+	for name, filters := range map[string][]JujuUserFilter{
+		"empty filter":            {JujuUserByUsername("alice"), {}},
+		"label value without key": {JujuUserByUsername("alice"), {LabelValue: &value}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+				_, err := GetJujuUsers(ctx, tx, filters...)
+				return err
+			})
+			if err == nil {
+				t.Fatalf("Expected the filters to be refused")
+			}
+		})
+	}
+}
+
+func TestJujuUserFilterClauseArguments(t *testing.T) {
+	filter := JujuUserByLabel("team", "a")
+	filter.Username = JujuUserByUsername("alice").Username
+	filter.ControllerID = JujuUserByControllerID(2).ControllerID
+
+	clause, args, err := jujuUserFilterClause(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "( jujuuser.username = ? AND jujuuser.controller_id = ? AND EXISTS ( SELECT 1 FROM jujuuser_labels WHERE jujuuser_labels.jujuuser_id = jujuuser.id AND jujuuser_labels.key = ? AND jujuuser_labels.value = ? ) )"
+	if clause != want {
+		t.Errorf("Expected clause %q, got %q", want, clause)
+	}
+
+	got := []string{}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case *string:
+			got = append(got, *v)
+		case *int64:
+			got = append(got, "controller")
+		}
+	}
+
+	if !reflect.DeepEqual(got, []string{"alice", "controller", "team", "a"}) {
+		t.Errorf("Unexpected argument order %q", got)
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// JujuUserHistoryEntry is a change made to a JujuUser, as recorded in its history.
+// Tokens are only ever referenced by their TokenFingerprint, empty when the user had no token.
+type JujuUserHistoryEntry struct {
+	ID                  int64
+	Username            string
+	Action              string
+	OldTokenFingerprint string
+	NewTokenFingerprint string
+	CreatedAt           time.Time
+	Actor               string
+
+	// MergedFrom is the username the entry was recorded under, when it was moved by MergeJujuUsers.
+	MergedFrom string
+}
+
+var jujuUserHistoryCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_history (username, action, old_token_fingerprint, new_token_fingerprint, created_at, actor)
+  VALUES (?, ?, ?, ?, ?, ?)
+`)
+
+var jujuUserHistoryObjectsByUsername = cluster.RegisterStmt(`
+SELECT jujuuser_history.id, jujuuser_history.username, jujuuser_history.action, jujuuser_history.old_token_fingerprint,
+       jujuuser_history.new_token_fingerprint, jujuuser_history.created_at, jujuuser_history.actor, jujuuser_history.merged_from
+  FROM jujuuser_history
+  WHERE jujuuser_history.username = ?
+  ORDER BY jujuuser_history.created_at, jujuuser_history.id
+`)
+
+var jujuUserHistoryLastFingerprint = cluster.RegisterStmt(`
+SELECT jujuuser_history.new_token_fingerprint
+  FROM jujuuser_history
+  WHERE jujuuser_history.username = ? AND jujuuser_history.merged_from = ''
+  ORDER BY jujuuser_history.id DESC
+  LIMIT 1
+`)
+
+var jujuUserTokenFingerprintByUsername = cluster.RegisterStmt(`
+SELECT jujuuser.token_fingerprint
+  FROM jujuuser
+  WHERE jujuuser.username = ?
+  ORDER BY jujuuser.id
+  LIMIT 1
+`)
+
+var jujuUserHistoryBaseline = cluster.RegisterStmt(`
+INSERT INTO jujuuser_history (username, action, old_token_fingerprint, new_token_fingerprint, created_at, actor)
+  SELECT jujuuser.username, 'baseline', '', jujuuser.token_fingerprint, ?, ?
+    FROM jujuuser
+    WHERE jujuuser.username NOT IN (SELECT jujuuser_history.username FROM jujuuser_history)
+    ORDER BY jujuuser.id
+`)
+
+// queryFingerprint returns the fingerprint selected by the statement with the given code, empty if there is none.
+func queryFingerprint(ctx context.Context, tx *sql.Tx, code int, username string) (string, error) {
+	stmt, err := prepareStmt(ctx, tx, code)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get \"jujuUserHistory\" prepared statement: %w", err)
+	}
+
+	var fingerprint string
+	err = stmt.QueryRowContext(ctx, username).Scan(&fingerprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fingerprint, nil
+}
+
+// appendJujuUserHistory records action on username in the history within tx, once the change is made.
+// The old fingerprint is the new one of the previous history entry, so each entry picks up where the
+// previous one left off. Entries moved over from a merged user are not part of that chain. The new fingerprint is read from the row, and is empty once deleted.
+func appendJujuUserHistory(ctx context.Context, tx *sql.Tx, action string, username string) error {
+	oldFingerprint, err := queryFingerprint(ctx, tx, jujuUserHistoryLastFingerprint, username)
+	if err != nil {
+		return fmt.Errorf("Failed to get last \"jujuuser_history\" entry of %q: %w", username, err)
+	}
+
+	newFingerprint := ""
+	if action != "delete" {
+		newFingerprint, err = queryFingerprint(ctx, tx, jujuUserTokenFingerprintByUsername, username)
+		if err != nil {
+			return fmt.Errorf("Failed to get token fingerprint of juju user %q: %w", username, err)
+		}
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserHistoryCreate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserHistoryCreate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, username, action, oldFingerprint, newFingerprint, time.Now().UTC(), ActorFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Failed to create \"jujuuser_history\" entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetJujuUserHistory returns the history of the JujuUser with the given username, oldest first.
+// The history outlives the user, so it is returned for deleted users too.
+func GetJujuUserHistory(ctx context.Context, tx *sql.Tx, username string) ([]JujuUserHistoryEntry, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserHistoryObjectsByUsername)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserHistoryObjectsByUsername\" prepared statement: %w", err)
+	}
+
+	entries := make([]JujuUserHistoryEntry, 0)
+
+	dest := func(scan func(dest ...any) error) error {
+		e := JujuUserHistoryEntry{}
+		err := scan(&e.ID, &e.Username, &e.Action, &e.OldTokenFingerprint, &e.NewTokenFingerprint, &e.CreatedAt, &e.Actor, &e.MergedFrom)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, e)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_history\" table: %w", err)
+	}
+
+	return entries, nil
+}
+
+// BackfillJujuUserHistory records a baseline entry, carrying the current token fingerprint, for every JujuUser
+// without history, such as the users created before the history was kept. It must run once the fingerprints
+// are backfilled, so that the first change recorded afterwards has the right old fingerprint.
+func BackfillJujuUserHistory(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserHistoryBaseline)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserHistoryBaseline\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, time.Now().UTC(), SystemActor)
+	if err != nil {
+		return fmt.Errorf("Failed to create baseline \"jujuuser_history\" entries: %w", err)
+	}
+
+	return nil
+}
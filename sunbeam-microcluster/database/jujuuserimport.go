@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// ImportMode selects how ImportJujuUsers handles invalid rows and users that already exist.
+type ImportMode int
+
+const (
+	// ImportModeFail validates the whole batch before writing and imports nothing if any row is invalid.
+	// Users that already exist fail the import with a conflict error.
+	ImportModeFail ImportMode = iota
+
+	// ImportModeSkip imports the valid rows of new users, leaving existing users alone.
+	ImportModeSkip
+
+	// ImportModeOverwrite imports the valid rows, overwriting the existing users.
+	ImportModeOverwrite
+)
+
+// JujuUserImportRowError is the reason the row at index Row of an import is invalid.
+type JujuUserImportRowError struct {
+	Row      int
+	Username string
+	Reason   string
+}
+
+// JujuUserImportValidationError lists all the invalid rows of an import.
+type JujuUserImportValidationError struct {
+	Rows []JujuUserImportRowError
+}
+
+// Error implements error.
+func (e *JujuUserImportValidationError) Error() string {
+	reasons := make([]string, 0, len(e.Rows))
+	for _, row := range e.Rows {
+		reasons = append(reasons, fmt.Sprintf("row %d (%q): %s", row.Row, row.Username, row.Reason))
+	}
+
+	return fmt.Sprintf("Invalid juju users import: %s", strings.Join(reasons, "; "))
+}
+
+// Status returns the HTTP status of the error.
+func (e *JujuUserImportValidationError) Status() int {
+	return http.StatusBadRequest
+}
+
+// validateJujuUserImport checks every row of an import and returns the reasons the invalid ones are refused,
+// in row order. A row repeating the username of an earlier row within the same controller is invalid, with
+// usernames compared following collation.
+func validateJujuUserImport(users []JujuUser, collation string) []JujuUserImportRowError {
+	rowErrors := []JujuUserImportRowError{}
+	foldCase := collation == UsernameCollationNoCase
+	seen := make(map[string]int, len(users))
+
+	for i, user := range users {
+		reason := ""
+
+		key := user.Username
+		if foldCase {
+			key = strings.ToLower(key)
+		}
+
+		controllerID := user.ControllerID
+		if controllerID == 0 {
+			controllerID = DefaultJujuControllerID
+		}
+
+		key = fmt.Sprintf("%d/%s", controllerID, key)
+		first, duplicate := seen[key]
+
+		switch {
+		case user.Username == "":
+			reason = "missing username"
+		case strings.IndexFunc(user.Username, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+			reason = "username contains whitespace or control characters"
+		case user.Token == "":
+			reason = "missing token"
+		case duplicate:
+			reason = fmt.Sprintf("duplicate of row %d", first)
+		}
+
+		if reason != "" {
+			rowErrors = append(rowErrors, JujuUserImportRowError{Row: i, Username: user.Username, Reason: reason})
+			continue
+		}
+
+		seen[key] = i
+	}
+
+	return rowErrors
+}
+
+// ImportReport lists, by outcome, the usernames of an ImportJujuUsers call.
+type ImportReport struct {
+	// Created holds the users that did not exist and were added.
+	Created []string
+
+	// Updated holds the existing users that were overwritten.
+	Updated []string
+
+	// Skipped holds the users that were not written, because their row is invalid or they already exist.
+	Skipped []string
+
+	// Conflicted holds the users that already existed, whether they were then updated or skipped.
+	Conflicted []string
+}
+
+// ImportJujuUsers adds the JujuUsers of a batch import within tx, handling invalid rows and existing users as
+// selected by mode. In ImportModeFail the whole batch is validated first and a JujuUserImportValidationError
+// listing every invalid row is returned without writing anything. The returned report tells what happened to
+// each user, up to the failing one on error.
+func ImportJujuUsers(ctx context.Context, tx *sql.Tx, users []JujuUser, mode ImportMode) (*ImportReport, error) {
+	report := &ImportReport{Created: []string{}, Updated: []string{}, Skipped: []string{}, Conflicted: []string{}}
+
+	err := CheckJujuUserBatchSize(len(users))
+	if err != nil {
+		return report, err
+	}
+
+	collation, err := UsernameCollation(ctx, tx)
+	if err != nil {
+		return report, err
+	}
+
+	rowErrors := validateJujuUserImport(users, collation)
+	if len(rowErrors) > 0 && mode == ImportModeFail {
+		return report, &JujuUserImportValidationError{Rows: rowErrors}
+	}
+
+	invalid := make(map[int]bool, len(rowErrors))
+	for _, rowError := range rowErrors {
+		invalid[rowError.Row] = true
+	}
+
+	for i, user := range users {
+		if invalid[i] {
+			report.Skipped = append(report.Skipped, user.Username)
+			continue
+		}
+
+		// Lock first so that the user cannot appear between checking for it and writing it.
+		err := LockJujuUserInController(ctx, tx, user.ControllerID, user.Username)
+		if err != nil {
+			return report, err
+		}
+
+		_, err = GetJujuUserInController(ctx, tx, user.ControllerID, user.Username)
+		if err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+			return report, err
+		}
+
+		exists := err == nil
+		if exists {
+			report.Conflicted = append(report.Conflicted, user.Username)
+		}
+
+		switch {
+		case !exists:
+			_, err = CreateJujuUser(ctx, tx, user)
+			if err == nil {
+				report.Created = append(report.Created, user.Username)
+			}
+
+		case mode == ImportModeOverwrite:
+			_, err = UpsertJujuUser(ctx, tx, user)
+			if err == nil {
+				report.Updated = append(report.Updated, user.Username)
+			}
+
+		case mode == ImportModeSkip:
+			report.Skipped = append(report.Skipped, user.Username)
+
+		default:
+			err = api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+		}
+
+		if err != nil {
+			return report, fmt.Errorf("Failed to import juju user %q at row %d: %w", user.Username, i, err)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// JujuUserLabel is used to attach free-form key/value labels to a JujuUser.
+type JujuUserLabel struct {
+	ID         int
+	JujuUserID int
+	Key        string
+	Value      string
+}
+
+var jujuUserLabelSet = cluster.RegisterStmt(`
+INSERT INTO jujuuser_labels (jujuuser_id, key, value)
+  VALUES (?, ?, ?)
+  ON CONFLICT(jujuuser_id, key) DO UPDATE SET value = excluded.value
+`)
+
+var jujuUserLabelObjectsByJujuUserID = cluster.RegisterStmt(`
+SELECT jujuuser_labels.key, jujuuser_labels.value
+  FROM jujuuser_labels
+  WHERE ( jujuuser_labels.jujuuser_id = ? )
+  ORDER BY jujuuser_labels.key
+`)
+
+var jujuUserObjectsByLabel = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  JOIN jujuuser_labels ON jujuuser_labels.jujuuser_id = jujuuser.id
+  WHERE ( jujuuser_labels.key = ? AND jujuuser_labels.value = ? )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+// SetJujuUserLabel sets the label key to value on the JujuUser with the given username, replacing any existing value.
+func SetJujuUserLabel(ctx context.Context, tx *sql.Tx, username string, key string, value string) error {
+	id, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserLabelSet)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserLabelSet\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, id, key, value)
+	if err != nil {
+		return fmt.Errorf("Failed to set \"jujuuser_labels\" entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetJujuUserLabels returns the labels of the JujuUser with the given username.
+func GetJujuUserLabels(ctx context.Context, tx *sql.Tx, username string) (map[string]string, error) {
+	id, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserLabelObjectsByJujuUserID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserLabelObjectsByJujuUserID\" prepared statement: %w", err)
+	}
+
+	labels := map[string]string{}
+
+	dest := func(scan func(dest ...any) error) error {
+		var key, value string
+		err := scan(&key, &value)
+		if err != nil {
+			return err
+		}
+
+		labels[key] = value
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_labels\" table: %w", err)
+	}
+
+	return labels, nil
+}
+
+// GetJujuUsersByLabel returns all JujuUsers carrying the label key with the given value.
+func GetJujuUsersByLabel(ctx context.Context, tx *sql.Tx, key string, value string) ([]JujuUser, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByLabel)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByLabel\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, key, value)
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserTouch = cluster.RegisterStmt(`
+UPDATE jujuuser SET last_used_at = ? WHERE username = ?
+`)
+
+var jujuUserObjectsUnusedSince = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.last_used_at IS NULL OR jujuuser.last_used_at < ? )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+// TouchJujuUser records that the token of the JujuUser with the given username was just used successfully.
+// Unlike the other updates it leaves updated_at alone, so the token age is unaffected.
+func TouchJujuUser(ctx context.Context, tx *sql.Tx, username string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserTouch)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserTouch\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, time.Now().UTC(), username)
+	if err != nil {
+		return fmt.Errorf("Failed to update last use of \"jujuuser\" entry %q: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows touching JujuUser %q: %w", username, err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	} else if n > 1 {
+		// Failing the transaction rolls back the update of the entries of the other controllers.
+		return ambiguousJujuUsernameError(username)
+	}
+
+	return nil
+}
+
+// GetDormantJujuUsers returns the JujuUsers whose token was not used since the given time, including the ones
+// whose token was never used.
+func GetDormantJujuUsers(ctx context.Context, tx *sql.Tx, since time.Time) ([]JujuUser, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsUnusedSince)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsUnusedSince\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, since.UTC())
+}
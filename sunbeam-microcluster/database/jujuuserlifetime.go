@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+// JujuUserLifetimeStats counts the JujuUsers ever created and ever deleted.
+type JujuUserLifetimeStats struct {
+	Created int64
+	Deleted int64
+}
+
+var jujuUserLifetimeStatsGet = cluster.RegisterStmt(`
+SELECT jujuuser_lifetime_stats.created, jujuuser_lifetime_stats.deleted
+  FROM jujuuser_lifetime_stats
+  WHERE jujuuser_lifetime_stats.id = 1
+`)
+
+var jujuUserLifetimeCreatedIncrement = cluster.RegisterStmt(`
+UPDATE jujuuser_lifetime_stats SET created = created + 1 WHERE id = 1
+`)
+
+var jujuUserLifetimeDeletedIncrement = cluster.RegisterStmt(`
+UPDATE jujuuser_lifetime_stats SET deleted = deleted + 1 WHERE id = 1
+`)
+
+// countJujuUserLifetimeChange increments the lifetime counter matching action within tx, so that the counters
+// are only ever updated together with the JujuUser row they count. Other actions are not counted.
+func countJujuUserLifetimeChange(ctx context.Context, tx *sql.Tx, action string) error {
+	var code int
+	switch action {
+	case "create":
+		code = jujuUserLifetimeCreatedIncrement
+	case "delete":
+		code = jujuUserLifetimeDeletedIncrement
+	default:
+		return nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, code)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserLifetime\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to update \"jujuuser_lifetime_stats\" table: %w", err)
+	}
+
+	return nil
+}
+
+// GetJujuUserLifetimeStats returns the number of JujuUsers ever created and ever deleted.
+// JujuUsers existing when the counters were introduced are counted as created.
+func GetJujuUserLifetimeStats(ctx context.Context, tx *sql.Tx) (*JujuUserLifetimeStats, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserLifetimeStatsGet)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserLifetimeStatsGet\" prepared statement: %w", err)
+	}
+
+	stats := JujuUserLifetimeStats{}
+	err = stmt.QueryRowContext(ctx).Scan(&stats.Created, &stats.Deleted)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_lifetime_stats\" table: %w", err)
+	}
+
+	return &stats, nil
+}
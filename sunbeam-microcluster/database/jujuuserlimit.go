@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// maxJujuUsers is the number of JujuUsers the database may hold, zero for no limit.
+var maxJujuUsers int
+var maxJujuUsersMu sync.RWMutex
+
+var jujuUserCount = cluster.RegisterStmt(`
+SELECT COUNT(*) FROM jujuuser
+`)
+
+// SetMaxJujuUsers sets the number of JujuUsers the database may hold, creations beyond it are refused.
+// A limit of zero disables the limit.
+func SetMaxJujuUsers(limit int) {
+	maxJujuUsersMu.Lock()
+	defer maxJujuUsersMu.Unlock()
+
+	maxJujuUsers = limit
+}
+
+// checkJujuUserLimit returns a 403 StatusError if adding one more JujuUser within tx would exceed the configured limit.
+// Counting within the creating transaction keeps concurrent creations from overshooting the limit, as dqlite
+// serializes the writers.
+func checkJujuUserLimit(ctx context.Context, tx *sql.Tx) error {
+	maxJujuUsersMu.RLock()
+	limit := maxJujuUsers
+	maxJujuUsersMu.RUnlock()
+
+	if limit <= 0 {
+		return nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserCount)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserCount\" prepared statement: %w", err)
+	}
+
+	var count int64
+	err = stmt.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("Failed to count \"jujuuser\" entries: %w", err)
+	}
+
+	if count >= int64(limit) {
+		return api.StatusErrorf(http.StatusForbidden, "The limit of %d juju users is reached", limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// appendJujuUserDisplayName appends suffix to the display name of the JujuUser within tx, a read-modify-write
+// that loses updates unless it holds the write lock before reading.
+func appendJujuUserDisplayName(ctx context.Context, tx *sql.Tx, username string, suffix string) error {
+	err := LockJujuUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetJujuUser(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	user.DisplayName += suffix
+
+	return UpdateJujuUser(ctx, tx, username, *user)
+}
+
+func TestLockJujuUserBlocksConcurrentWriter(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			err := LockJujuUser(ctx, tx, "alice")
+			if err != nil {
+				return err
+			}
+
+			close(locked)
+			<-release
+
+			return appendJujuUserDisplayName(ctx, tx, "alice", "a")
+		})
+	}()
+
+	<-locked
+
+	second := make(chan error, 1)
+	go func() {
+		second <- testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			return appendJujuUserDisplayName(ctx, tx, "alice", "b")
+		})
+	}()
+
+	select {
+	case err := <-second:
+		t.Fatalf("Expected the second writer to wait for the lock, it finished with %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+
+	err := <-first
+	if err != nil {
+		t.Fatalf("First writer failed: %v", err)
+	}
+
+	err = <-second
+	if err != nil {
+		t.Fatalf("Second writer failed: %v", err)
+	}
+
+	var user *JujuUser
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		user, err = GetJujuUser(ctx, tx, "alice")
+		return err
+	})
+
+	if user.DisplayName != "ab" {
+		t.Fatalf("Expected the second writer to apply its update on top of the first, got %q", user.DisplayName)
+	}
+}
+
+func TestLockJujuUserNoLostUpdate(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+
+	const writers = 8
+	const updates = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*updates)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < updates; j++ {
+				errs <- testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+					return appendJujuUserDisplayName(ctx, tx, "alice", "x")
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent update failed: %v", err)
+		}
+	}
+
+	var user *JujuUser
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		user, err = GetJujuUser(ctx, tx, "alice")
+		return err
+	})
+
+	expected := strings.Repeat("x", writers*updates)
+	if user.DisplayName != expected {
+		t.Fatalf("Expected %d updates to be applied, got %d", len(expected), len(user.DisplayName))
+	}
+
+	if user.Token != "token" {
+		t.Fatalf("Expected the token to be kept, got %q", user.Token)
+	}
+}
+
+func TestJujuUserTokenRotationsKeepOneInput(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+
+	const writers = 8
+	const rotations = 5
+
+	tokens := map[string]bool{}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*rotations)
+	for i := 0; i < writers; i++ {
+		for j := 0; j < rotations; j++ {
+			tokens[fmt.Sprintf("token-%d-%d", i, j)] = true
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < rotations; j++ {
+				token := fmt.Sprintf("token-%d-%d", i, j)
+				errs <- testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+					// Alternate both token writers so they also race with each other.
+					if j%2 == 0 {
+						_, err := UpdateJujuUserTokens(ctx, tx, map[string]string{"alice": token}, false)
+						return err
+					}
+
+					// Reading the current token for the swap is itself a read-modify-write.
+					err := LockJujuUser(ctx, tx, "alice")
+					if err != nil {
+						return err
+					}
+
+					user, err := GetJujuUser(ctx, tx, "alice")
+					if err != nil {
+						return err
+					}
+
+					_, err = CompareAndSetJujuUserToken(ctx, tx, "alice", user.Token, token)
+					return err
+				})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent token rotation failed: %v", err)
+		}
+	}
+
+	var user *JujuUser
+	var matches []JujuUser
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		user, err = GetJujuUser(ctx, tx, "alice")
+		if err != nil {
+			return err
+		}
+
+		matches, err = GetJujuUsersByTokenFingerprint(ctx, tx, TokenFingerprint(user.Token))
+		return err
+	})
+
+	if !tokens[user.Token] {
+		t.Fatalf("Expected the final token to be one of the rotated tokens, got %q", user.Token)
+	}
+
+	if len(matches) != 1 || matches[0].Username != "alice" {
+		t.Fatalf("Expected the fingerprint to match the final token, got %+v", matches)
+	}
+}
+
+func TestGetJujuUsersForUpdateBlocksConcurrentReconcile(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			_, err := GetJujuUsersForUpdate(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			close(locked)
+			<-release
+
+			_, err = CreateJujuUser(ctx, tx, JujuUser{Username: "bob", Token: "token"})
+			return err
+		})
+	}()
+
+	<-locked
+
+	type result struct {
+		users []JujuUser
+		err   error
+	}
+
+	second := make(chan result, 1)
+	go func() {
+		var users []JujuUser
+		err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			users, err = GetJujuUsersForUpdate(ctx, tx)
+			return err
+		})
+
+		second <- result{users: users, err: err}
+	}()
+
+	select {
+	case r := <-second:
+		t.Fatalf("Expected the second reconcile to wait for the first, it returned %d users and %v", len(r.users), r.err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Plain reads are not blocked by the reconcile holding the lock.
+	var users []JujuUser
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		users, err = GetJujuUsers(ctx, tx)
+		return err
+	})
+
+	if len(users) != 1 {
+		t.Fatalf("Expected a plain read to see the committed user only, got %d users", len(users))
+	}
+
+	close(release)
+
+	err := <-first
+	if err != nil {
+		t.Fatalf("First reconcile failed: %v", err)
+	}
+
+	r := <-second
+	if r.err != nil {
+		t.Fatalf("Second reconcile failed: %v", r.err)
+	}
+
+	if len(r.users) != 2 {
+		t.Fatalf("Expected the second reconcile to see the changes of the first, got %d users", len(r.users))
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserHistoryMerge = cluster.RegisterStmt(`
+UPDATE jujuuser_history
+  SET username = ?, merged_from = CASE WHEN merged_from = '' THEN ? ELSE merged_from END
+  WHERE username = ?
+`)
+
+// MergeJujuUsers merges the JujuUser mergeUsername into the JujuUser keepUsername within tx, for when a duplicate
+// account is discovered. The kept user gains the roles of the merged one it lacks, and its labels with a key it
+// does not have, its own labels win on conflicts. The merged user is deleted and its history, including its
+// deletion, is moved to the kept user with MergedFrom set. The merge is then recorded on the kept user.
+// The kept user keeps its token.
+func MergeJujuUsers(ctx context.Context, tx *sql.Tx, keepUsername string, mergeUsername string) error {
+	if keepUsername == mergeUsername {
+		return api.StatusErrorf(http.StatusBadRequest, "Cannot merge JujuUser %q into itself", keepUsername)
+	}
+
+	for _, username := range []string{keepUsername, mergeUsername} {
+		err := LockJujuUser(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	keep, err := GetJujuUser(ctx, tx, keepUsername)
+	if err != nil {
+		return err
+	}
+
+	merge, err := GetJujuUser(ctx, tx, mergeUsername)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserRolesMerge)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserRolesMerge\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, keep.ID, merge.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to merge \"jujuuser_roles\" entries of %q into %q: %w", mergeUsername, keepUsername, err)
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserLabelsMerge)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserLabelsMerge\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, keep.ID, merge.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to merge \"jujuuser_labels\" entries of %q into %q: %w", mergeUsername, keepUsername, err)
+	}
+
+	// The kept user now holds any admin role of the merged one.
+	err = DeleteJujuUserWithOptions(ctx, tx, mergeUsername, DeleteJujuUserOptions{Force: true})
+	if err != nil {
+		return err
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserHistoryMerge)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserHistoryMerge\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, keepUsername, mergeUsername, mergeUsername)
+	if err != nil {
+		return fmt.Errorf("Failed to move \"jujuuser_history\" entries of %q to %q: %w", mergeUsername, keepUsername, err)
+	}
+
+	return recordJujuUserChange(ctx, tx, "merge", keepUsername)
+}
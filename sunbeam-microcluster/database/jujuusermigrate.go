@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserUsernameUpdateByID = cluster.RegisterStmt(`
+UPDATE jujuuser SET username = ? WHERE id = ?
+`)
+
+// MigrateJujuUserTable rewrites every JujuUser with the result of transform, within tx so that either the whole
+// table is migrated or, if transform or any write fails, none of it.
+// Entries keep their ID, so rows referencing them such as labels are left untouched. The table is rewritten in
+// place rather than copied and swapped, as dropping it would cascade to those rows.
+func MigrateJujuUserTable(ctx context.Context, tx *sql.Tx, transform func(JujuUser) (JujuUser, error)) error {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// Transform everything before writing anything.
+	migrated := make([]JujuUser, 0, len(objects))
+	for _, object := range objects {
+		result, err := transform(object)
+		if err != nil {
+			return fmt.Errorf("Failed to migrate juju user %q: %w", object.Username, err)
+		}
+
+		if result.Username != object.Username {
+			err := CheckJujuUserRouteName(result.Username)
+			if err != nil {
+				return fmt.Errorf("Failed to migrate juju user %q: %w", object.Username, err)
+			}
+		}
+
+		result.ID = object.ID
+		migrated = append(migrated, result)
+	}
+
+	// Unique constraints are checked after every statement, so move all usernames out of the way first
+	// in case the transform swaps usernames between entries.
+	stmt, err := prepareStmt(ctx, tx, jujuUserUsernameUpdateByID)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserUsernameUpdateByID\" prepared statement: %w", err)
+	}
+
+	for _, object := range objects {
+		_, err := stmt.ExecContext(ctx, fmt.Sprintf("\x00migrating-%d", object.ID), object.ID)
+		if err != nil {
+			return fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+		}
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserUpdate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserUpdate\" prepared statement: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for i, object := range migrated {
+		object.TokenFingerprint = TokenFingerprint(object.Token)
+		token, version, err := sealToken(object.Token)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.ExecContext(ctx, object.Username, token, jujuUserControllerID(object.ControllerID), now, version, nullString(object.DisplayName), nullTokenMeta(object.TokenMeta), object.TokenFingerprint, object.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to migrate \"jujuuser\" entry %d: %w", object.ID, err)
+		}
+
+		if !reflect.DeepEqual(object, objects[i]) {
+			err = recordJujuUserChange(ctx, tx, "update", object.Username)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
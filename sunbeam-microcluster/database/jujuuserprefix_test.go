@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// jujuUsernames returns the usernames of all juju users, one per entry.
+func jujuUsernames(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	usernames := []string{}
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		users, err := GetJujuUsers(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			usernames = append(usernames, user.Username)
+		}
+
+		return nil
+	})
+
+	return usernames
+}
+
+// deleteByPrefix runs DeleteJujuUsersByPrefix in its own transaction.
+func deleteByPrefix(db *sql.DB, prefix string, expectedCount int) (int, error) {
+	var deleted int
+	err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		deleted, err = DeleteJujuUsersByPrefix(ctx, tx, prefix, expectedCount)
+		return err
+	})
+
+	return deleted, err
+}
+
+func TestDeleteJujuUsersByPrefix(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuController(t, db, 2)
+	mustCreateJujuUser(t, db, JujuUser{Username: "tenant-a", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "tenant-b", Token: "token-2"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "tenant-b", Token: "token-3", ControllerID: 2})
+	mustCreateJujuUser(t, db, JujuUser{Username: "other", Token: "token-4"})
+
+	// The username under both controllers counts once and is deleted from both.
+	deleted, err := deleteByPrefix(db, "tenant-", 2)
+	if err != nil {
+		t.Fatalf("Failed to delete by prefix: %v", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted usernames, got %d", deleted)
+	}
+
+	got := jujuUsernames(t, db)
+	if !reflect.DeepEqual(got, []string{"other"}) {
+		t.Errorf("Expected only %q to be left, got %q", "other", got)
+	}
+}
+
+func TestDeleteJujuUsersByPrefixCountMismatch(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "tenant-a", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "tenant-b", Token: "token-2"})
+
+	for _, expected := range []int{1, 3} {
+		_, err := deleteByPrefix(db, "tenant-", expected)
+		assertStatus(t, err, http.StatusConflict)
+	}
+
+	got := jujuUsernames(t, db)
+	if !reflect.DeepEqual(got, []string{"tenant-a", "tenant-b"}) {
+		t.Errorf("Expected nothing to be deleted, got %q left", got)
+	}
+
+	_, err := deleteByPrefix(db, "", 0)
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestDeleteJujuUsersByPrefixWildcards(t *testing.T) {
+	for _, collation := range []string{UsernameCollationBinary, UsernameCollationNoCase} {
+		t.Run(collation, func(t *testing.T) {
+			db := newTestDBWithCollation(t, collation)
+			for _, username := range []string{"a*b", "axb", "a?c", "ayc", "a[d]", "ad", "a_e", "aze", "a%f", "azzf", `a\g`} {
+				mustCreateJujuUser(t, db, JujuUser{Username: username, Token: "token-" + username})
+			}
+
+			for _, prefix := range []string{"a*", "a?", "a[", "a_", "a%", `a\`} {
+				_, err := deleteByPrefix(db, prefix, 1)
+				if err != nil {
+					t.Errorf("Expected prefix %q to match a single juju user: %v", prefix, err)
+				}
+			}
+
+			got := jujuUsernames(t, db)
+			if !reflect.DeepEqual(got, []string{"ad", "axb", "ayc", "aze", "azzf"}) {
+				t.Errorf("Expected the wildcards to match literally, got %q left", got)
+			}
+		})
+	}
+}
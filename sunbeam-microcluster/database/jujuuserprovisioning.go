@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserNeedsProvisioningSetByID = cluster.RegisterStmt(`
+UPDATE jujuuser SET needs_provisioning = 1 WHERE id = ?
+`)
+
+var jujuUserNeedsProvisioningClear = cluster.RegisterStmt(`
+UPDATE jujuuser SET needs_provisioning = 0 WHERE username = ?
+`)
+
+var jujuUserObjectsNeedingProvisioning = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.needs_provisioning = 1 )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+// BackfillJujuUserNeedsProvisioning flags every JujuUser with an empty token as needing provisioning, telling
+// the legacy entries that were never provisioned apart from the provisioned ones.
+// Tokens are compared once opened, as empty tokens are not empty once encrypted.
+func BackfillJujuUserNeedsProvisioning(ctx context.Context, tx *sql.Tx) error {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserNeedsProvisioningSetByID)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserNeedsProvisioningSetByID\" prepared statement: %w", err)
+	}
+
+	for _, object := range objects {
+		if object.Token != "" || object.TokenUnavailable {
+			continue
+		}
+
+		_, err = stmt.ExecContext(ctx, object.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to flag \"jujuuser\" entry %d as needing provisioning: %w", object.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetJujuUsersNeedingProvisioning returns the JujuUsers flagged as needing provisioning.
+func GetJujuUsersNeedingProvisioning(ctx context.Context, tx *sql.Tx) ([]JujuUser, error) {
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsNeedingProvisioning)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsNeedingProvisioning\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt)
+}
+
+// MarkJujuUserProvisioned clears the needs provisioning flag of the JujuUser with the given username, once it
+// was given a token.
+func MarkJujuUserProvisioned(ctx context.Context, tx *sql.Tx, username string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserNeedsProvisioningClear)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserNeedsProvisioningClear\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, username)
+	if err != nil {
+		return fmt.Errorf("Failed to update \"jujuuser\" entry %q: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows marking JujuUser %q provisioned: %w", username, err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	} else if n > 1 {
+		// Failing the transaction rolls back the update of the entries of the other controllers.
+		return ambiguousJujuUsernameError(username)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// RenameAndRekeyJujuUser renames the JujuUser oldUsername to newUsername and replaces its token with newToken
+// within tx, as required for compromised accounts. Its roles and labels follow it. Like UpdateJujuUser, a not
+// found error is returned if oldUsername does not exist, and like CreateJujuUser, a conflict error if
+// newUsername already exists in its controller. Both checks run before anything is written, so that on failure
+// neither change applies. The change is recorded as a rename of oldUsername and an update of newUsername.
+func RenameAndRekeyJujuUser(ctx context.Context, tx *sql.Tx, oldUsername string, newUsername string, newToken string) error {
+	if newUsername == "" {
+		return api.StatusErrorf(http.StatusBadRequest, "Cannot rename JujuUser %q to an empty username", oldUsername)
+	}
+
+	if newToken == "" {
+		return api.StatusErrorf(http.StatusBadRequest, "Cannot rekey JujuUser %q with an empty token", oldUsername)
+	}
+
+	err := LockJujuUser(ctx, tx, oldUsername)
+	if err != nil {
+		return err
+	}
+
+	object, err := GetJujuUser(ctx, tx, oldUsername)
+	if err != nil {
+		return err
+	}
+
+	if newUsername != oldUsername {
+		stmt, err := prepareStmt(ctx, tx, jujuUserIDByControllerIDAndUsername)
+		if err != nil {
+			return fmt.Errorf("Failed to get \"jujuUserIDByControllerIDAndUsername\" prepared statement: %w", err)
+		}
+
+		var existingID int64
+		err = stmt.QueryRowContext(ctx, object.ControllerID, newUsername).Scan(&existingID)
+		if err == nil {
+			return api.StatusErrorf(http.StatusConflict, "JujuUser %q already exists", newUsername)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("Failed to check for duplicates: %w", err)
+		}
+	}
+
+	object.Username = newUsername
+	object.Token = newToken
+
+	err = UpdateJujuUser(ctx, tx, oldUsername, *object)
+	if err != nil {
+		return err
+	}
+
+	if newUsername == oldUsername {
+		return nil
+	}
+
+	return recordJujuUserChange(ctx, tx, "rename", oldUsername)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// SelfTestJujuUsername is the username of the temporary JujuUser created by the self-test of the credential store.
+const SelfTestJujuUsername = "sunbeam-self-test"
+
+// DefaultReservedJujuUsernames are the usernames of the JujuUsers internal to Juju, such as the controller admin,
+// and of the self-test user.
+var DefaultReservedJujuUsernames = []string{"admin", SelfTestJujuUsername}
+
+// jujuUserRouteNames are the usernames taken by the fixed /1.0/jujuusers/<name> endpoints of the API, which
+// would shadow the endpoint of a JujuUser with the same username.
+var jujuUserRouteNames = map[string]bool{
+	"batch":    true,
+	"events":   true,
+	"maintain": true,
+	"metrics":  true,
+	"rotate":   true,
+	"stats":    true,
+}
+
+// CheckJujuUserRouteName returns a bad request error if username is taken by an API endpoint. It is checked
+// whenever a JujuUser is given a new username.
+func CheckJujuUserRouteName(username string) error {
+	if jujuUserRouteNames[username] {
+		return api.StatusErrorf(http.StatusBadRequest, "Juju username %q is reserved by the API", username)
+	}
+
+	return nil
+}
+
+// reservedJujuUsernames is the set of usernames hidden from the listings of JujuUsers filtered with ExcludeReserved.
+var reservedJujuUsernames = newReservedJujuUsernames(DefaultReservedJujuUsernames)
+var reservedJujuUsernamesMu sync.RWMutex
+
+// newReservedJujuUsernames returns the set of the given usernames.
+func newReservedJujuUsernames(usernames []string) map[string]bool {
+	reserved := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		reserved[username] = true
+	}
+
+	return reserved
+}
+
+// SetReservedJujuUsernames replaces the set of reserved usernames, which are hidden from the listings of
+// JujuUsers filtered with ExcludeReserved.
+func SetReservedJujuUsernames(usernames ...string) {
+	reservedJujuUsernamesMu.Lock()
+	defer reservedJujuUsernamesMu.Unlock()
+
+	reservedJujuUsernames = newReservedJujuUsernames(usernames)
+}
+
+// ReservedJujuUsernames returns the reserved usernames, sorted.
+func ReservedJujuUsernames() []string {
+	reservedJujuUsernamesMu.RLock()
+	defer reservedJujuUsernamesMu.RUnlock()
+
+	usernames := make([]string, 0, len(reservedJujuUsernames))
+	for username := range reservedJujuUsernames {
+		usernames = append(usernames, username)
+	}
+
+	sort.Strings(usernames)
+
+	return usernames
+}
+
+// IsReservedJujuUsername reports whether username is reserved.
+func IsReservedJujuUsername(username string) bool {
+	reservedJujuUsernamesMu.RLock()
+	defer reservedJujuUsernamesMu.RUnlock()
+
+	return reservedJujuUsernames[username]
+}
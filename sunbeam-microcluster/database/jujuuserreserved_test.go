@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+func TestJujuUserRouteNamesRejected(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1"})
+
+	writes := map[string]func(ctx context.Context, tx *sql.Tx) error{
+		"CreateJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "stats", Token: "token-2"})
+			return err
+		},
+		"GenerateAndCreateJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := GenerateAndCreateJujuUser(ctx, tx, "rotate", RandomTokenGenerator{})
+			return err
+		},
+		"UpdateJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			return UpdateJujuUser(ctx, tx, "alice", JujuUser{Username: "batch", Token: "token-1"})
+		},
+		"RenameAndRekeyJujuUser": func(ctx context.Context, tx *sql.Tx) error {
+			return RenameAndRekeyJujuUser(ctx, tx, "alice", "metrics", "token-2")
+		},
+		"ImportJujuUsers": func(ctx context.Context, tx *sql.Tx) error {
+			_, err := ImportJujuUsers(ctx, tx, []JujuUser{{Username: "events", Token: "token-2"}}, ImportModeOverwrite)
+			return err
+		},
+		"MigrateJujuUserTable": func(ctx context.Context, tx *sql.Tx) error {
+			return MigrateJujuUserTable(ctx, tx, func(user JujuUser) (JujuUser, error) {
+				user.Username = "maintain"
+				return user, nil
+			})
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			err := testTransaction(db)(context.Background(), write)
+			assertStatus(t, err, http.StatusBadRequest)
+		})
+	}
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		usernames, err := ListJujuUsernames(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if len(usernames) != 1 || usernames[0] != "alice" {
+			t.Fatalf("Expected only %q to exist, got %v", "alice", usernames)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+)
+
+// TokenHash returns the hex encoded SHA-256 of token, the form in which revocation lists reference tokens.
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// GetJujuUsersByTokenHash returns the JujuUsers whose token hashes, as computed by TokenHash, to one of hashes.
+// Hashes are matched ignoring case. Tokens may be encrypted at rest so the hashes cannot be matched by the
+// database, every token is decrypted and hashed instead.
+func GetJujuUsersByTokenHash(ctx context.Context, tx *sql.Tx, hashes []string) ([]JujuUser, error) {
+	wanted := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[strings.ToLower(hash)] = true
+	}
+
+	matches := []JujuUser{}
+	if len(wanted) == 0 {
+		return matches, nil
+	}
+
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		if object.Token != "" && wanted[TokenHash(object.Token)] {
+			matches = append(matches, object)
+		}
+	}
+
+	return matches, nil
+}
+
+// ClearJujuUserTokens empties the token of the JujuUsers with the given usernames, so that they have to be
+// provisioned a new one. Unknown usernames fail the whole batch with a not found error.
+// It returns the number of cleared tokens.
+func ClearJujuUserTokens(ctx context.Context, tx *sql.Tx, usernames []string) (int, error) {
+	updates := make(map[string]string, len(usernames))
+	for _, username := range usernames {
+		updates[username] = ""
+	}
+
+	return UpdateJujuUserTokens(ctx, tx, updates, false)
+}
+
+// RevokeJujuUserTokensByHash empties the token of every JujuUser whose token hashes to one of hashes and returns
+// the usernames of the affected users.
+func RevokeJujuUserTokensByHash(ctx context.Context, tx *sql.Tx, hashes []string) ([]string, error) {
+	objects, err := GetJujuUsersByTokenHash(ctx, tx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make([]string, 0, len(objects))
+	for _, object := range objects {
+		usernames = append(usernames, object.Username)
+	}
+
+	_, err = ClearJujuUserTokens(ctx, tx, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	return usernames, nil
+}
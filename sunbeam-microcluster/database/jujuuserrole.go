@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// Cluster roles a JujuUser can hold.
+const (
+	JujuUserRoleAdmin    = "admin"
+	JujuUserRoleOperator = "operator"
+	JujuUserRoleViewer   = "viewer"
+)
+
+// JujuUserRoles is the list of valid JujuUser roles.
+var JujuUserRoles = []string{JujuUserRoleAdmin, JujuUserRoleOperator, JujuUserRoleViewer}
+
+// JujuUserRole is used to track the cluster roles held by a JujuUser.
+type JujuUserRole struct {
+	ID         int
+	JujuUserID int
+	Role       string
+}
+
+var jujuUserRoleCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_roles (jujuuser_id, role)
+  VALUES (?, ?)
+  ON CONFLICT(jujuuser_id, role) DO NOTHING
+`)
+
+var jujuUserRoleDelete = cluster.RegisterStmt(`
+DELETE FROM jujuuser_roles WHERE jujuuser_id = ? AND role = ?
+`)
+
+var jujuUserRoleObjectsByJujuUserID = cluster.RegisterStmt(`
+SELECT jujuuser_roles.role
+  FROM jujuuser_roles
+  WHERE ( jujuuser_roles.jujuuser_id = ? )
+  ORDER BY jujuuser_roles.role
+`)
+
+var jujuUserObjectsByRole = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  JOIN jujuuser_roles ON jujuuser_roles.jujuuser_id = jujuuser.id
+  WHERE ( jujuuser_roles.role = ? )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+var jujuUserRoleAdminCounts = cluster.RegisterStmt(`
+SELECT COUNT(CASE WHEN jujuuser.username = ? THEN 1 END), COUNT(*)
+  FROM jujuuser_roles
+  JOIN jujuuser ON jujuuser.id = jujuuser_roles.jujuuser_id
+  WHERE ( jujuuser_roles.role = ? )
+`)
+
+// checkNotLastJujuUserAdmin returns a conflict error if the JujuUser with the given username is the only one
+// holding the admin role, so that removing it does not lock everyone out of the juju controller.
+func checkNotLastJujuUserAdmin(ctx context.Context, tx *sql.Tx, username string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserRoleAdminCounts)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserRoleAdminCounts\" prepared statement: %w", err)
+	}
+
+	var held, total int64
+	err = stmt.QueryRowContext(ctx, username, JujuUserRoleAdmin).Scan(&held, &total)
+	if err != nil {
+		return fmt.Errorf("Failed to count \"jujuuser_roles\" admin entries: %w", err)
+	}
+
+	if held > 0 && total == held {
+		return api.StatusErrorf(http.StatusConflict, "JujuUser %q is the last one with the %q role", username, JujuUserRoleAdmin)
+	}
+
+	return nil
+}
+
+// validateJujuUserRole checks role is one of JujuUserRoles.
+func validateJujuUserRole(role string) error {
+	for _, valid := range JujuUserRoles {
+		if role == valid {
+			return nil
+		}
+	}
+
+	return api.StatusErrorf(http.StatusBadRequest, "Invalid juju user role %q, expected one of %v", role, JujuUserRoles)
+}
+
+// AddJujuUserRole grants role to the JujuUser with the given username. Granting a role already held is a no-op.
+func AddJujuUserRole(ctx context.Context, tx *sql.Tx, username string, role string) error {
+	err := validateJujuUserRole(role)
+	if err != nil {
+		return err
+	}
+
+	id, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserRoleCreate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserRoleCreate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, id, role)
+	if err != nil {
+		return fmt.Errorf("Failed to create \"jujuuser_roles\" entry: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveJujuUserRole revokes role from the JujuUser with the given username.
+func RemoveJujuUserRole(ctx context.Context, tx *sql.Tx, username string, role string) error {
+	err := validateJujuUserRole(role)
+	if err != nil {
+		return err
+	}
+
+	id, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserRoleDelete)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserRoleDelete\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, id, role)
+	if err != nil {
+		return fmt.Errorf("Delete \"jujuuser_roles\": %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q does not hold role %q", username, role)
+	}
+
+	return nil
+}
+
+// GetJujuUserRoles returns the roles held by the JujuUser with the given username.
+func GetJujuUserRoles(ctx context.Context, tx *sql.Tx, username string) ([]string, error) {
+	id, err := GetJujuUserID(ctx, tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserRoleObjectsByJujuUserID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserRoleObjectsByJujuUserID\" prepared statement: %w", err)
+	}
+
+	roles := []string{}
+
+	dest := func(scan func(dest ...any) error) error {
+		var role string
+		err := scan(&role)
+		if err != nil {
+			return err
+		}
+
+		roles = append(roles, role)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_roles\" table: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetJujuUsersByRole returns all JujuUsers holding role.
+func GetJujuUsersByRole(ctx context.Context, tx *sql.Tx, role string) ([]JujuUser, error) {
+	err := validateJujuUserRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByRole)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByRole\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, role)
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// RotationPlan maps usernames to their new token, as produced by the security tooling under a unique ID.
+type RotationPlan struct {
+	ID     string            `json:"id"`
+	Tokens map[string]string `json:"tokens"`
+}
+
+// RotationResult is the outcome of ApplyRotationPlan. Applied is false when the plan had been applied before.
+type RotationResult struct {
+	PlanID    string
+	Applied   bool
+	Rotated   int
+	AppliedAt time.Time
+}
+
+var jujuUserRotationPlanByID = cluster.RegisterStmt(`
+SELECT jujuuser_rotation_plans.applied_at FROM jujuuser_rotation_plans
+  WHERE jujuuser_rotation_plans.plan_id = ?
+`)
+
+var jujuUserRotationPlanCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_rotation_plans (plan_id, applied_at, rotated)
+  VALUES (?, ?, ?)
+`)
+
+// ApplyRotationPlan sets the token of every user of the plan, after checking that all of them exist, and
+// records the plan ID so that applying the same plan again is a no-op. Everything happens within tx, so either
+// the whole plan is applied and recorded or, on any error, none of it.
+func ApplyRotationPlan(ctx context.Context, tx *sql.Tx, plan RotationPlan) (RotationResult, error) {
+	if plan.ID == "" {
+		return RotationResult{}, api.StatusErrorf(http.StatusBadRequest, "Rotation plan has no ID")
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserRotationPlanByID)
+	if err != nil {
+		return RotationResult{}, fmt.Errorf("Failed to get \"jujuUserRotationPlanByID\" prepared statement: %w", err)
+	}
+
+	var appliedAt time.Time
+	err = stmt.QueryRowContext(ctx, plan.ID).Scan(&appliedAt)
+	if err == nil {
+		return RotationResult{PlanID: plan.ID, AppliedAt: appliedAt}, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return RotationResult{}, fmt.Errorf("Failed to get \"jujuuser_rotation_plans\" entry %q: %w", plan.ID, err)
+	}
+
+	usernames := make([]string, 0, len(plan.Tokens))
+	for username := range plan.Tokens {
+		usernames = append(usernames, username)
+	}
+
+	err = CheckJujuUserBatchSize(len(usernames))
+	if err != nil {
+		return RotationResult{}, err
+	}
+
+	exist, err := JujuUsersExist(ctx, tx, usernames)
+	if err != nil {
+		return RotationResult{}, err
+	}
+
+	missing := []string{}
+	for _, username := range usernames {
+		if !exist[username] {
+			missing = append(missing, username)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return RotationResult{}, api.StatusErrorf(http.StatusNotFound, "Rotation plan %q references unknown juju users: %s", plan.ID, strings.Join(missing, ", "))
+	}
+
+	rotated, err := UpdateJujuUserTokens(ctx, tx, plan.Tokens, false)
+	if err != nil {
+		return RotationResult{}, err
+	}
+
+	appliedAt = time.Now().UTC()
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserRotationPlanCreate)
+	if err != nil {
+		return RotationResult{}, fmt.Errorf("Failed to get \"jujuUserRotationPlanCreate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, plan.ID, appliedAt, rotated)
+	if err != nil {
+		return RotationResult{}, fmt.Errorf("Failed to create \"jujuuser_rotation_plans\" entry: %w", err)
+	}
+
+	return RotationResult{PlanID: plan.ID, Applied: true, Rotated: rotated, AppliedAt: appliedAt}, nil
+}
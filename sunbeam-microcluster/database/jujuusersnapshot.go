@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// ListJujuUsersSnapshot returns the JujuUsers matching whereClause, ordered by username.
+// It is meant for report jobs that run several queries on the same tx to get a consistent point-in-time view.
+// The clause must be parameterized: all values are passed through args and bound to ? placeholders,
+// and an empty clause matches every user.
+func ListJujuUsersSnapshot(ctx context.Context, tx *sql.Tx, whereClause string, args ...any) ([]JujuUser, error) {
+	err := validateWhereClause(whereClause, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(whereClause) == "" {
+		whereClause = "1 = 1"
+	}
+
+	return getJujuUsersRaw(ctx, tx, fmt.Sprintf(jujuUserObjectsTemplate, jujuUserColumns(), whereClause), args...)
+}
+
+// validateWhereClause checks clause holds no inline values, statement separators or comments, and has exactly
+// as many ? placeholders as there are arguments.
+func validateWhereClause(clause string, args int) error {
+	placeholders := 0
+	prevIdent := false
+
+	for i := 0; i < len(clause); i++ {
+		c := clause[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			return api.StatusErrorf(http.StatusBadRequest, "Inline values are not allowed in where clause, use ? placeholders")
+		case c >= '0' && c <= '9' && !prevIdent:
+			return api.StatusErrorf(http.StatusBadRequest, "Inline values are not allowed in where clause, use ? placeholders")
+		case c == ';':
+			return api.StatusErrorf(http.StatusBadRequest, "Statement separators are not allowed in where clause")
+		case strings.HasPrefix(clause[i:], "--") || strings.HasPrefix(clause[i:], "/*"):
+			return api.StatusErrorf(http.StatusBadRequest, "Comments are not allowed in where clause")
+		case c == '?':
+			placeholders++
+		}
+
+		// Digits are only allowed within identifiers, a dot continues the identifier before it.
+		if c != '.' {
+			prevIdent = c == '_' || (prevIdent && c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		}
+	}
+
+	if placeholders != args {
+		return api.StatusErrorf(http.StatusBadRequest, "Where clause has %d placeholders but %d arguments were given", placeholders, args)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+// encryptedEmptyTokenLength is the length of an empty token once encrypted by encryptToken,
+// which only holds the nonce and the authentication tag.
+var encryptedEmptyTokenLength = base64.StdEncoding.EncodedLen(12 + 16)
+
+var jujuUserCounts = cluster.RegisterStmt(`
+SELECT COUNT(*),
+       COUNT(CASE WHEN jujuuser.token IS NULL
+                    OR (jujuuser.token_key_version = '' AND jujuuser.token = '')
+                    OR (jujuuser.token_key_version != '' AND LENGTH(jujuuser.token) = ?)
+             THEN 1 END)
+  FROM jujuuser
+`)
+
+// The bounds are read as the column itself rather than through MIN and MAX, which lose the column type
+// and would have to be parsed back into a time.
+var jujuUserOldestUpdatedAt = cluster.RegisterStmt(`
+SELECT jujuuser.updated_at
+  FROM jujuuser
+  WHERE ( jujuuser.updated_at IS NOT NULL )
+  ORDER BY jujuuser.updated_at ASC
+  LIMIT 1
+`)
+
+var jujuUserNewestUpdatedAt = cluster.RegisterStmt(`
+SELECT jujuuser.updated_at
+  FROM jujuuser
+  WHERE ( jujuuser.updated_at IS NOT NULL )
+  ORDER BY jujuuser.updated_at DESC
+  LIMIT 1
+`)
+
+// JujuUserStats summarizes the content of the jujuuser table.
+type JujuUserStats struct {
+	Total       int64
+	EmptyTokens int64
+
+	// OldestUpdatedAt and NewestUpdatedAt are zero when the table is empty.
+	OldestUpdatedAt time.Time
+	NewestUpdatedAt time.Time
+}
+
+// GetJujuUserStats returns the number of JujuUsers, how many of them have no token, and the range of their
+// last update times. Tokens are not decrypted, empty encrypted tokens are recognized by their length.
+func GetJujuUserStats(ctx context.Context, tx *sql.Tx) (*JujuUserStats, error) {
+	stats := &JujuUserStats{}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserCounts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserCounts\" prepared statement: %w", err)
+	}
+
+	err = stmt.QueryRowContext(ctx, encryptedEmptyTokenLength).Scan(&stats.Total, &stats.EmptyTokens)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to count \"jujuuser\" entries: %w", err)
+	}
+
+	stats.OldestUpdatedAt, err = getJujuUserUpdatedAtBound(ctx, tx, jujuUserOldestUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.NewestUpdatedAt, err = getJujuUserUpdatedAtBound(ctx, tx, jujuUserNewestUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// getJujuUserUpdatedAtBound returns the update time selected by the registered statement stmtCode,
+// or the zero time if there are no JujuUsers.
+func getJujuUserUpdatedAtBound(ctx context.Context, tx *sql.Tx, stmtCode int) (time.Time, error) {
+	stmt, err := prepareStmt(ctx, tx, stmtCode)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get \"jujuuser\" update time prepared statement: %w", err)
+	}
+
+	var updatedAt time.Time
+	err = stmt.QueryRowContext(ctx).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get \"jujuuser\" update time: %w", err)
+	}
+
+	return updatedAt, nil
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// JujuUserStore holds JujuUsers. Code written against it rather than the package functions can be exercised
+// without a database by passing a MemoryJujuUserStore.
+type JujuUserStore interface {
+	// GetJujuUsers returns the JujuUsers matching any of the filters, or all of them without filters,
+	// ordered by username.
+	GetJujuUsers(ctx context.Context, filters ...JujuUserFilter) ([]JujuUser, error)
+
+	// GetJujuUser returns the JujuUser with the given username, or a not found error.
+	GetJujuUser(ctx context.Context, username string) (*JujuUser, error)
+
+	// CreateJujuUser adds a new JujuUser and returns its ID, or a conflict error if it already exists.
+	CreateJujuUser(ctx context.Context, object JujuUser) (int64, error)
+
+	// UpdateJujuUser overwrites the JujuUser with the given username with object, or returns a not found error.
+	UpdateJujuUser(ctx context.Context, username string, object JujuUser) error
+
+	// DeleteJujuUser deletes the JujuUser with the given username, or returns a not found error.
+	DeleteJujuUser(ctx context.Context, username string) error
+}
+
+// txJujuUserStore is the JujuUserStore backed by the database through a transaction.
+type txJujuUserStore struct {
+	tx *sql.Tx
+}
+
+// NewJujuUserStore returns the JujuUserStore reading and writing the database within tx.
+func NewJujuUserStore(tx *sql.Tx) JujuUserStore {
+	return &txJujuUserStore{tx: tx}
+}
+
+func (s *txJujuUserStore) GetJujuUsers(ctx context.Context, filters ...JujuUserFilter) ([]JujuUser, error) {
+	return GetJujuUsers(ctx, s.tx, filters...)
+}
+
+func (s *txJujuUserStore) GetJujuUser(ctx context.Context, username string) (*JujuUser, error) {
+	return GetJujuUser(ctx, s.tx, username)
+}
+
+func (s *txJujuUserStore) CreateJujuUser(ctx context.Context, object JujuUser) (int64, error) {
+	return CreateJujuUser(ctx, s.tx, object)
+}
+
+func (s *txJujuUserStore) UpdateJujuUser(ctx context.Context, username string, object JujuUser) error {
+	return UpdateJujuUser(ctx, s.tx, username, object)
+}
+
+func (s *txJujuUserStore) DeleteJujuUser(ctx context.Context, username string) error {
+	return DeleteJujuUser(ctx, s.tx, username)
+}
+
+// MemoryJujuUserStore is a JujuUserStore keeping JujuUsers in memory, meant to stand in for the database.
+// It only knows about the default controller, and neither labels nor roles.
+type MemoryJujuUserStore struct {
+	mu     sync.Mutex
+	nextID int64
+	users  map[string]JujuUser
+}
+
+// NewMemoryJujuUserStore returns a MemoryJujuUserStore holding a copy of users.
+func NewMemoryJujuUserStore(users ...JujuUser) *MemoryJujuUserStore {
+	s := &MemoryJujuUserStore{users: map[string]JujuUser{}}
+	for _, user := range users {
+		_, _ = s.CreateJujuUser(context.Background(), user)
+	}
+
+	return s
+}
+
+func (s *MemoryJujuUserStore) GetJujuUsers(_ context.Context, filters ...JujuUserFilter) ([]JujuUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects := []JujuUser{}
+	for _, user := range s.users {
+		match := len(filters) == 0
+		for _, filter := range filters {
+			ok, err := memoryJujuUserMatches(user, filter)
+			if err != nil {
+				return nil, err
+			}
+
+			match = match || ok
+		}
+
+		if match {
+			objects = append(objects, user)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Username < objects[j].Username })
+
+	return objects, nil
+}
+
+// memoryJujuUserMatches reports whether user matches all the criteria of filter.
+func memoryJujuUserMatches(user JujuUser, filter JujuUserFilter) (bool, error) {
+	if filter.LabelKey != nil || filter.LabelValue != nil {
+		return false, fmt.Errorf("Label filters are not supported by the in-memory juju user store")
+	}
+
+	switch {
+	case filter.Username != nil && user.Username != *filter.Username:
+		return false, nil
+	case filter.DisplayName != nil && user.DisplayName != *filter.DisplayName:
+		return false, nil
+	case filter.ControllerID != nil && user.ControllerID != *filter.ControllerID:
+		return false, nil
+	case filter.HasToken != nil && (user.Token != "") != *filter.HasToken:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (s *MemoryJujuUserStore) GetJujuUser(_ context.Context, username string) (*JujuUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	}
+
+	return &user, nil
+}
+
+func (s *MemoryJujuUserStore) CreateJujuUser(_ context.Context, object JujuUser) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.users[object.Username]
+	if ok {
+		return -1, api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+	}
+
+	s.nextID++
+	now := time.Now().UTC()
+
+	object.ID = int(s.nextID)
+	object.CreatedAt = now
+	object.UpdatedAt = now
+	object.TokenSet = true
+	object.TokenFingerprint = TokenFingerprint(object.Token)
+	object.ControllerID = jujuUserControllerID(object.ControllerID)
+
+	s.users[object.Username] = object
+
+	return s.nextID, nil
+}
+
+func (s *MemoryJujuUserStore) UpdateJujuUser(_ context.Context, username string, object JujuUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[username]
+	if !ok {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	}
+
+	if object.Username != username {
+		_, ok := s.users[object.Username]
+		if ok {
+			return api.StatusErrorf(http.StatusConflict, "This \"jujuuser\" entry already exists")
+		}
+	}
+
+	object.ID = current.ID
+	object.CreatedAt = current.CreatedAt
+	object.UpdatedAt = time.Now().UTC()
+	object.TokenSet = true
+	object.TokenFingerprint = TokenFingerprint(object.Token)
+
+	delete(s.users, username)
+	s.users[object.Username] = object
+
+	return nil
+}
+
+func (s *MemoryJujuUserStore) DeleteJujuUser(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.users[username]
+	if !ok {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	}
+
+	delete(s.users, username)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/canonical/lxd/shared/api"
+)
+
+// DefaultJujuUsernameSuggestions is the number of usernames suggested when a JujuUser is not found.
+const DefaultJujuUsernameSuggestions = 3
+
+// GetJujuUserWithSuggestions returns the JujuUser with the given key like GetJujuUser. If it is not found, the
+// returned not found error names up to limit existing usernames close to username, to help with typos.
+// Looking for suggestions lists every username, so it only happens once the lookup missed.
+func GetJujuUserWithSuggestions(ctx context.Context, tx *sql.Tx, username string, limit int) (*JujuUser, error) {
+	object, err := GetJujuUser(ctx, tx, username)
+	if err == nil || !api.StatusErrorCheck(err, http.StatusNotFound) {
+		return object, err
+	}
+
+	suggestions, suggestErr := SuggestJujuUsernames(ctx, tx, username, limit)
+	if suggestErr != nil || len(suggestions) == 0 {
+		return nil, err
+	}
+
+	return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found, did you mean %s?", username, quoteJujuUsernames(suggestions))
+}
+
+// SuggestJujuUsernames returns up to limit existing usernames close to username, closest first. A username is
+// close if it starts with username, or if it is within a few single character edits of it.
+func SuggestJujuUsernames(ctx context.Context, tx *sql.Tx, username string, limit int) ([]string, error) {
+	usernames, err := ListJujuUsernames(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow an edit for every three characters, and at least two.
+	maxDistance := len(username) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	distances := map[string]int{}
+	for _, candidate := range usernames {
+		distance := levenshtein(strings.ToLower(username), strings.ToLower(candidate))
+		if distance <= maxDistance || (username != "" && strings.HasPrefix(candidate, username)) {
+			distances[candidate] = distance
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for candidate := range distances {
+		suggestions = append(suggestions, candidate)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+
+		return suggestions[i] < suggestions[j]
+	})
+
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+// quoteJujuUsernames returns usernames quoted and joined for an error message.
+func quoteJujuUsernames(usernames []string) string {
+	quoted := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		quoted = append(quoted, fmt.Sprintf("%q", username))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// levenshtein returns the number of single character insertions, deletions and substitutions turning a into b.
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// tokenFingerprintLength is the number of hex digits of TokenHash kept as the fingerprint of a token.
+const tokenFingerprintLength = 16
+
+var jujuUserTokenFingerprintUpdateByID = cluster.RegisterStmt(`
+UPDATE jujuuser SET token_fingerprint = ? WHERE id = ?
+`)
+
+var jujuUserObjectsByTokenFingerprint = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.token_fingerprint = ? )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+// jujuUserObjectsByTokenFingerprintPrefix matches a prefix as a range rather than with LIKE, which SQLite only
+// serves from the jujuuser_token_fingerprint index under conditions the connection does not guarantee.
+var jujuUserObjectsByTokenFingerprintPrefix = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.token_fingerprint >= ? AND jujuuser.token_fingerprint < ? )
+  ORDER BY jujuuser.username
+`, jujuUserColumns()))
+
+// TokenFingerprint returns the fingerprint of token, the first hex digits of its TokenHash, or the empty string
+// for an empty token. It identifies a token in logs and API responses without exposing it, identical tokens
+// always have the same fingerprint.
+func TokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	return TokenHash(token)[:tokenFingerprintLength]
+}
+
+// GetJujuUsersByTokenFingerprint returns the JujuUsers whose token has the given fingerprint, matched ignoring
+// case, for example to find who a token seen in a log belongs to.
+func GetJujuUsersByTokenFingerprint(ctx context.Context, tx *sql.Tx, fingerprint string) ([]JujuUser, error) {
+	if fingerprint == "" {
+		return []JujuUser{}, nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByTokenFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByTokenFingerprint\" prepared statement: %w", err)
+	}
+
+	return getJujuUsers(ctx, stmt, strings.ToLower(fingerprint))
+}
+
+// GetJujuUsersByTokenFingerprintPrefix returns the JujuUsers whose token fingerprint starts with prefix, matched
+// ignoring case, so that a truncated fingerprint is enough to look a token up. Tokens are encrypted with a random
+// nonce, so their stored value can't be looked up by prefix and the fingerprint stands in for it.
+func GetJujuUsersByTokenFingerprintPrefix(ctx context.Context, tx *sql.Tx, prefix string) ([]JujuUser, error) {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" || len(prefix) > tokenFingerprintLength {
+		return nil, api.StatusErrorf(http.StatusBadRequest, "Token fingerprint prefix must be 1 to %d hex digits", tokenFingerprintLength)
+	}
+
+	// Decode the prefix padded to an even length, to check that it only has hex digits.
+	_, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2))
+	if err != nil {
+		return nil, api.StatusErrorf(http.StatusBadRequest, "Token fingerprint prefix must be 1 to %d hex digits", tokenFingerprintLength)
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByTokenFingerprintPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByTokenFingerprintPrefix\" prepared statement: %w", err)
+	}
+
+	// Fingerprints only hold hex digits, all of which sort before "g".
+	return getJujuUsers(ctx, stmt, prefix, prefix+"g")
+}
+
+// BackfillJujuUserTokenFingerprints computes the token fingerprint of every JujuUser, which only the writes
+// since the token_fingerprint column was added maintain.
+func BackfillJujuUserTokenFingerprints(ctx context.Context, tx *sql.Tx) error {
+	_, err := RecomputeJujuUserTokenFingerprints(ctx, tx)
+
+	return err
+}
+
+// RecomputeJujuUserTokenFingerprints fixes the token fingerprint of every JujuUser whose fingerprint does not
+// match its token, and returns how many it fixed.
+func RecomputeJujuUserTokenFingerprints(ctx context.Context, tx *sql.Tx) (int, error) {
+	objects, err := GetJujuUsers(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokenFingerprintUpdateByID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserTokenFingerprintUpdateByID\" prepared statement: %w", err)
+	}
+
+	fixed := 0
+	for _, object := range objects {
+		// The fingerprint of an unavailable token can't be checked, the stored one is kept.
+		if object.TokenUnavailable {
+			continue
+		}
+
+		fingerprint := TokenFingerprint(object.Token)
+		if fingerprint == object.TokenFingerprint {
+			continue
+		}
+
+		_, err = stmt.ExecContext(ctx, fingerprint, object.ID)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to set token fingerprint of \"jujuuser\" entry %d: %w", object.ID, err)
+		}
+
+		fixed++
+	}
+
+	return fixed, nil
+}
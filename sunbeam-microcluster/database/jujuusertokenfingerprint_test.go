@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+// queryPlan returns the details of the EXPLAIN QUERY PLAN rows of the registered statement code run with args.
+func queryPlan(t *testing.T, db *sql.DB, code int, args ...any) string {
+	t.Helper()
+
+	stmt, err := cluster.StmtString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+stmt, args...)
+	if err != nil {
+		t.Fatalf("Failed to explain the query plan: %v", err)
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	details := []string{}
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		err := rows.Scan(&id, &parent, &notUsed, &detail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		details = append(details, detail)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Join(details, "\n")
+}
+
+func TestJujuUserTokenFingerprintQueriesUseIndex(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := map[string]struct {
+		code int
+		args []any
+	}{
+		"exact":  {code: jujuUserObjectsByTokenFingerprint, args: []any{"0123456789abcdef"}},
+		"prefix": {code: jujuUserObjectsByTokenFingerprintPrefix, args: []any{"0123", "0123g"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := queryPlan(t, db, test.code, test.args...)
+			if !strings.Contains(plan, "USING INDEX jujuuser_token_fingerprint") {
+				t.Errorf("Expected the query to use index jujuuser_token_fingerprint, got plan:\n%s", plan)
+			}
+		})
+	}
+}
+
+// seedJujuUsers adds count juju users directly, with the fingerprints of their plain text tokens.
+func seedJujuUsers(b *testing.B, db *sql.DB, count int) {
+	b.Helper()
+
+	mustTransaction(b, db, func(ctx context.Context, tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO jujuuser (username, token, token_fingerprint, created_at, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+		if err != nil {
+			return err
+		}
+
+		defer func() { _ = stmt.Close() }()
+
+		for i := 0; i < count; i++ {
+			token := fmt.Sprintf("token-%d", i)
+			_, err := stmt.ExecContext(ctx, fmt.Sprintf("user-%d", i), token, TokenFingerprint(token))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func BenchmarkGetJujuUsersByTokenFingerprint(b *testing.B) {
+	const count = 50000
+
+	db := newTestDB(b)
+	seedJujuUsers(b, db, count)
+
+	fingerprint := TokenFingerprint(fmt.Sprintf("token-%d", count/2))
+	for name, lookup := range map[string]func(ctx context.Context, tx *sql.Tx) ([]JujuUser, error){
+		"exact": func(ctx context.Context, tx *sql.Tx) ([]JujuUser, error) {
+			return GetJujuUsersByTokenFingerprint(ctx, tx, fingerprint)
+		},
+		"prefix": func(ctx context.Context, tx *sql.Tx) ([]JujuUser, error) {
+			return GetJujuUsersByTokenFingerprintPrefix(ctx, tx, fingerprint[:8])
+		},
+	} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mustTransaction(b, db, func(ctx context.Context, tx *sql.Tx) error {
+					users, err := lookup(ctx, tx)
+					if err != nil {
+						return err
+					}
+
+					if len(users) == 0 {
+						b.Fatalf("Expected fingerprint %q to match a juju user", fingerprint)
+					}
+
+					return nil
+				})
+			}
+		})
+	}
+}
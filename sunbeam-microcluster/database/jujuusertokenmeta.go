@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserTokenMetaUpdate = cluster.RegisterStmt(`
+UPDATE jujuuser SET token_meta = ? WHERE username = ?
+`)
+
+// GetJujuUserTokenMeta returns the token metadata of the JujuUser with the given username, nil if it has none.
+func GetJujuUserTokenMeta(ctx context.Context, tx *sql.Tx, username string) (json.RawMessage, error) {
+	object, err := GetJujuUser(ctx, tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.TokenMeta, nil
+}
+
+// SetJujuUserTokenMeta replaces the token metadata of the JujuUser with the given username with meta, which must
+// be valid JSON. An empty or JSON null meta removes the metadata. The token itself and its age are left alone.
+func SetJujuUserTokenMeta(ctx context.Context, tx *sql.Tx, username string, meta json.RawMessage) error {
+	if len(meta) > 0 && !json.Valid(meta) {
+		return api.StatusErrorf(http.StatusBadRequest, "Invalid token metadata for JujuUser %q: not valid JSON", username)
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokenMetaUpdate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserTokenMetaUpdate\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, nullTokenMeta(meta), username)
+	if err != nil {
+		return fmt.Errorf("Failed to update token metadata of \"jujuuser\" entry %q: %w", username, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Fetch affected rows updating JujuUser %q: %w", username, err)
+	}
+
+	if n == 0 {
+		return api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found", username)
+	} else if n > 1 {
+		// Failing the transaction rolls back the update of the entries of the other controllers.
+		return ambiguousJujuUsernameError(username)
+	}
+
+	return recordJujuUserChange(ctx, tx, "update", username)
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// jujuUserLockInController is jujuUserLock for the entry of a single controller.
+var jujuUserLockInController = cluster.RegisterStmt(`
+UPDATE jujuuser SET id = id WHERE controller_id = ? AND username = ?
+`)
+
+// The token helpers below are the controller scoped counterparts of GetJujuUserToken, CompareAndSetJujuUserToken
+// and RotateAllJujuUserTokens. The same username, and so the same looking token, may exist under several
+// controllers: these only ever read and write the entry of the given controller, a zero controller ID
+// selecting DefaultJujuControllerID as on create.
+
+// LockJujuUserInController is LockJujuUser for the JujuUser with the given username within controllerID, which
+// unlike LockJujuUser does not fail when the username exists under other controllers too.
+func LockJujuUserInController(ctx context.Context, tx *sql.Tx, controllerID int64, username string) error {
+	stmt, err := prepareStmt(ctx, tx, jujuUserLockInController)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserLockInController\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, jujuUserControllerID(controllerID), username)
+	if err != nil {
+		return fmt.Errorf("Failed to lock \"jujuuser\" entry %q of controller %d: %w", username, controllerID, err)
+	}
+
+	return nil
+}
+
+// GetJujuUserInController returns the JujuUser with the given username within controllerID.
+func GetJujuUserInController(ctx context.Context, tx *sql.Tx, controllerID int64, username string) (*JujuUser, error) {
+	if controllerID == 0 {
+		controllerID = DefaultJujuControllerID
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByControllerIDAndUsername)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"jujuUserObjectsByControllerIDAndUsername\" prepared statement: %w", err)
+	}
+
+	objects, err := getJujuUsers(ctx, stmt, controllerID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return nil, api.StatusErrorf(http.StatusNotFound, "JujuUser %q not found in controller %d", username, controllerID)
+	}
+
+	return &objects[0], nil
+}
+
+// GetJujuUserTokenInController returns the token of the JujuUser with the given username within controllerID.
+func GetJujuUserTokenInController(ctx context.Context, tx *sql.Tx, controllerID int64, username string) (string, error) {
+	object, err := GetJujuUserInController(ctx, tx, controllerID, username)
+	if err != nil {
+		return "", err
+	}
+
+	err = object.TokenErr()
+	if err != nil {
+		return "", err
+	}
+
+	return object.Token, nil
+}
+
+// CompareAndSetJujuUserTokenInController replaces the token of the JujuUser with the given username within
+// controllerID with newToken only if it currently equals oldToken. It returns whether the token was swapped.
+func CompareAndSetJujuUserTokenInController(ctx context.Context, tx *sql.Tx, controllerID int64, username string, oldToken string, newToken string) (bool, error) {
+	err := LockJujuUserInController(ctx, tx, controllerID, username)
+	if err != nil {
+		return false, err
+	}
+
+	object, err := GetJujuUserInController(ctx, tx, controllerID, username)
+	if err != nil {
+		return false, err
+	}
+
+	if object.Token != oldToken {
+		return false, nil
+	}
+
+	err = setJujuUserToken(ctx, tx, object, newToken)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RotateJujuUserTokensInController replaces the token of every JujuUser of controllerID with one produced by
+// generator. It returns the number of rotated users.
+func RotateJujuUserTokensInController(ctx context.Context, tx *sql.Tx, controllerID int64, generator func(username string) (string, error)) (int, error) {
+	if controllerID == 0 {
+		controllerID = DefaultJujuControllerID
+	}
+
+	objects, err := GetJujuUsers(ctx, tx, JujuUserByControllerID(controllerID))
+	if err != nil {
+		return 0, err
+	}
+
+	return rotateJujuUserTokens(ctx, tx, objects, generator)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+var jujuUserObjectsByControllerIDAndUsername = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s
+  FROM jujuuser
+  WHERE ( jujuuser.controller_id = ? AND jujuuser.username = ? )
+`, jujuUserColumns()))
+
+// UpsertJujuUser creates the JujuUser or, if it already exists within its controller, overwrites it with object.
+func UpsertJujuUser(ctx context.Context, tx *sql.Tx, object JujuUser) (int64, error) {
+	return UpsertJujuUserFunc(ctx, tx, object, func(_ JujuUser, incoming JujuUser) JujuUser {
+		return incoming
+	})
+}
+
+// UpsertJujuUserFunc creates the JujuUser or, if it already exists within its controller, writes the result of
+// calling resolve with the existing and incoming entries. The username and controller of the existing entry
+// are kept whatever resolve returns. It returns the ID of the entry.
+func UpsertJujuUserFunc(ctx context.Context, tx *sql.Tx, object JujuUser, resolve func(existing JujuUser, incoming JujuUser) JujuUser) (int64, error) {
+	object.ControllerID = jujuUserControllerID(object.ControllerID)
+
+	// Lock first so that the entry cannot change between reading and resolving it.
+	err := LockJujuUserInController(ctx, tx, object.ControllerID, object.Username)
+	if err != nil {
+		return -1, err
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserObjectsByControllerIDAndUsername)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"jujuUserObjectsByControllerIDAndUsername\" prepared statement: %w", err)
+	}
+
+	objects, err := getJujuUsers(ctx, stmt, object.ControllerID, object.Username)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(objects) == 0 {
+		return CreateJujuUserWithOptions(ctx, tx, object, CreateJujuUserOptions{SkipDuplicateCheck: true})
+	}
+
+	existing := objects[0]
+	merged := resolve(existing, object)
+
+	token, version, err := sealToken(merged.Token)
+	if err != nil {
+		return -1, err
+	}
+
+	stmt, err = prepareStmt(ctx, tx, jujuUserUpdate)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"jujuUserUpdate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, existing.Username, token, jujuUserControllerID(existing.ControllerID), time.Now().UTC(), version, nullString(merged.DisplayName), nullTokenMeta(merged.TokenMeta), TokenFingerprint(merged.Token), existing.ID)
+	if err != nil {
+		return -1, fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+	}
+
+	err = recordJujuUserChange(ctx, tx, "update", existing.Username)
+	if err != nil {
+		return -1, err
+	}
+
+	return int64(existing.ID), nil
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/canonical/lxd/shared/logger"
+)
+
+// ScrubbedLogValue replaces sensitive values in log entries.
+const ScrubbedLogValue = "***"
+
+// scrubMaxDepth bounds how deep nested values are scrubbed, which also stops on cyclic values.
+const scrubMaxDepth = 8
+
+// sensitiveLogFields holds the lower cased names of the log context keys and struct fields to scrub.
+var sensitiveLogFields = map[string]bool{"token": true}
+var sensitiveLogFieldsMu sync.RWMutex
+
+// AddSensitiveLogFields adds names to the log context keys and struct fields scrubbed from log entries.
+// Names are matched ignoring case.
+func AddSensitiveLogFields(names ...string) {
+	sensitiveLogFieldsMu.Lock()
+	defer sensitiveLogFieldsMu.Unlock()
+
+	for _, name := range names {
+		sensitiveLogFields[strings.ToLower(name)] = true
+	}
+}
+
+// isSensitiveLogField reports whether values named name must be scrubbed.
+func isSensitiveLogField(name string) bool {
+	sensitiveLogFieldsMu.RLock()
+	defer sensitiveLogFieldsMu.RUnlock()
+
+	return sensitiveLogFields[strings.ToLower(name)]
+}
+
+// scrubbingLogger scrubs sensitive values from the context of entries before passing them to its target.
+type scrubbingLogger struct {
+	target logger.Logger
+}
+
+// NewScrubbingLogger returns a logger passing entries to target with the values of sensitive fields, such as
+// JujuUser tokens, replaced by ScrubbedLogValue. This covers both sensitive context keys and sensitive fields
+// of the logged values, for example a whole JujuUser.
+func NewScrubbingLogger(target logger.Logger) logger.Logger {
+	return &scrubbingLogger{target: target}
+}
+
+func (l *scrubbingLogger) Panic(msg string, ctx ...logger.Ctx) {
+	l.target.Panic(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Fatal(msg string, ctx ...logger.Ctx) {
+	l.target.Fatal(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Error(msg string, ctx ...logger.Ctx) {
+	l.target.Error(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Warn(msg string, ctx ...logger.Ctx) {
+	l.target.Warn(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Info(msg string, ctx ...logger.Ctx) {
+	l.target.Info(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Debug(msg string, ctx ...logger.Ctx) {
+	l.target.Debug(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) Trace(msg string, ctx ...logger.Ctx) {
+	l.target.Trace(msg, scrubLogCtxs(ctx)...)
+}
+
+func (l *scrubbingLogger) AddContext(ctx logger.Ctx) logger.Logger {
+	return &scrubbingLogger{target: l.target.AddContext(scrubLogCtx(ctx))}
+}
+
+// scrubLogCtxs returns scrubbed copies of ctxs.
+func scrubLogCtxs(ctxs []logger.Ctx) []logger.Ctx {
+	scrubbed := make([]logger.Ctx, 0, len(ctxs))
+	for _, ctx := range ctxs {
+		scrubbed = append(scrubbed, scrubLogCtx(ctx))
+	}
+
+	return scrubbed
+}
+
+// scrubLogCtx returns a copy of ctx with sensitive values scrubbed.
+func scrubLogCtx(ctx logger.Ctx) logger.Ctx {
+	scrubbed := make(logger.Ctx, len(ctx))
+	for key, value := range ctx {
+		if isSensitiveLogField(key) {
+			scrubbed[key] = ScrubbedLogValue
+			continue
+		}
+
+		if value == nil {
+			scrubbed[key] = nil
+			continue
+		}
+
+		scrubbed[key] = scrubLogValue(reflect.ValueOf(value), 0).Interface()
+	}
+
+	return scrubbed
+}
+
+// scrubLogValue returns a copy of v with its sensitive string fields and map entries scrubbed.
+// Values only reachable through unexported fields are left untouched.
+func scrubLogValue(v reflect.Value, depth int) reflect.Value {
+	if depth > scrubMaxDepth {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(scrubLogValue(v.Elem(), depth+1))
+
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.New(v.Type()).Elem()
+		out.Set(scrubLogValue(v.Elem(), depth+1))
+
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if field.Type.Kind() == reflect.String && isSensitiveLogField(field.Name) {
+				out.Field(i).SetString(ScrubbedLogValue)
+				continue
+			}
+
+			out.Field(i).Set(scrubLogValue(v.Field(i), depth+1))
+		}
+
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(scrubLogValue(v.Index(i), depth+1))
+		}
+
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		scrubbed := reflect.ValueOf(ScrubbedLogValue)
+
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			if key.Kind() == reflect.String && isSensitiveLogField(key.String()) && scrubbed.Type().AssignableTo(v.Type().Elem()) {
+				out.SetMapIndex(key, scrubbed)
+				continue
+			}
+
+			out.SetMapIndex(key, scrubLogValue(iter.Value(), depth+1))
+		}
+
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/canonical/lxd/shared/logger"
+)
+
+// MaintainJujuUserTable prunes the outbox events past OutboxRetention, refreshes the query planner statistics
+// of the jujuuser table and, when the database uses incremental auto vacuum, reclaims its free pages.
+// It changes no juju user data, so it is safe to call at any time, for example on a schedule after bulk changes.
+func MaintainJujuUserTable(ctx context.Context, transaction Transactor) error {
+	return transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		pruned, err := PruneOutboxEvents(ctx, tx, OutboxRetention)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "ANALYZE jujuuser")
+		if err != nil {
+			return fmt.Errorf("Failed to analyze \"jujuuser\" table: %w", err)
+		}
+
+		// 0 is none, 1 is full and 2 is incremental, only the latter leaves free pages to reclaim.
+		var autoVacuum int
+		err = tx.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum)
+		if err != nil {
+			return fmt.Errorf("Failed to get auto vacuum mode: %w", err)
+		}
+
+		vacuumed := autoVacuum == 2
+		if vacuumed {
+			_, err = tx.ExecContext(ctx, "PRAGMA incremental_vacuum")
+			if err != nil {
+				return fmt.Errorf("Failed to vacuum database: %w", err)
+			}
+		}
+
+		logger.Info("Maintained juju user table", logger.Ctx{"pruned_events": pruned, "analyzed": true, "vacuumed": vacuumed})
+
+		return nil
+	})
+}
+
+// JujuUserMaintenanceStep is the outcome of one step of MaintainJujuUsers, Changed counts the rows it changed.
+type JujuUserMaintenanceStep struct {
+	Name    string
+	Changed int64
+}
+
+// MaintainJujuUsers runs the periodic security maintenance of the juju users, in order:
+//   - "reseal" encrypts the tokens not encrypted with the current key yet, see ResealJujuUserTokens.
+//   - "fingerprint" fixes the stale token fingerprints, see RecomputeJujuUserTokenFingerprints.
+//   - "purge" removes the expired delete intents and the outbox events past OutboxRetention.
+//   - "compact" refreshes the statistics and reclaims the free pages, see MaintainJujuUserTable.
+//
+// Each step runs in its own transaction and only changes what it still has to, so if a step fails the steps
+// before it stay done and running MaintainJujuUsers again resumes where it failed. It returns the outcome of
+// the steps that completed.
+func MaintainJujuUsers(ctx context.Context, transaction Transactor) ([]JujuUserMaintenanceStep, error) {
+	steps := []struct {
+		name string
+		run  func(ctx context.Context, tx *sql.Tx) (int64, error)
+	}{
+		{name: "reseal", run: func(ctx context.Context, tx *sql.Tx) (int64, error) {
+			n, err := ResealJujuUserTokens(ctx, tx)
+
+			return int64(n), err
+		}},
+		{name: "fingerprint", run: func(ctx context.Context, tx *sql.Tx) (int64, error) {
+			n, err := RecomputeJujuUserTokenFingerprints(ctx, tx)
+
+			return int64(n), err
+		}},
+		{name: "purge", run: func(ctx context.Context, tx *sql.Tx) (int64, error) {
+			intents, err := PurgeExpiredJujuUserDeleteIntents(ctx, tx)
+			if err != nil {
+				return 0, err
+			}
+
+			events, err := PruneOutboxEvents(ctx, tx, OutboxRetention)
+			if err != nil {
+				return 0, err
+			}
+
+			return intents + events, nil
+		}},
+	}
+
+	report := make([]JujuUserMaintenanceStep, 0, len(steps)+1)
+	for _, step := range steps {
+		var changed int64
+		err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			changed, err = step.run(ctx, tx)
+
+			return err
+		})
+		if err != nil {
+			return report, fmt.Errorf("Juju user maintenance step %q failed: %w", step.name, err)
+		}
+
+		logger.Info("Ran juju user maintenance step", logger.Ctx{"step": step.name, "changed": changed})
+		report = append(report, JujuUserMaintenanceStep{Name: step.name, Changed: changed})
+	}
+
+	// The outbox is pruned already, this only leaves the statistics and free pages.
+	err := MaintainJujuUserTable(ctx, transaction)
+	if err != nil {
+		return report, fmt.Errorf("Juju user maintenance step %q failed: %w", "compact", err)
+	}
+
+	report = append(report, JujuUserMaintenanceStep{Name: "compact"})
+
+	return report, nil
+}
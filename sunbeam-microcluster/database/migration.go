@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/lxd/shared/logger"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// JujuUserSchemaComponent is the SchemaVersion component tracking JujuUserMigrations.
+const JujuUserSchemaComponent = "jujuuser"
+
+// Migration is a single runtime migration step.
+type Migration func(ctx context.Context, tx *sql.Tx) error
+
+// JujuUserMigrations are the runtime migrations of the jujuuser table, applied in order by ApplyMigrations.
+// Structural changes must remain SchemaExtensions so that they are in place before statements get prepared;
+// this list is meant for data migrations that can run while the daemon serves requests.
+var JujuUserMigrations = []Migration{
+	BackfillJujuUserNeedsProvisioning,
+	BackfillJujuUserTokenFingerprints,
+	BackfillJujuUserHistory,
+}
+
+// SchemaVersion records the number of migrations applied for a component.
+type SchemaVersion struct {
+	Component string
+	Version   int
+}
+
+// Transactor runs f within a database transaction, as done by state.Database.Transaction.
+type Transactor func(ctx context.Context, f func(context.Context, *sql.Tx) error) error
+
+var schemaVersionByComponent = cluster.RegisterStmt(`
+SELECT schema_versions.version FROM schema_versions
+  WHERE schema_versions.component = ?
+`)
+
+var schemaVersionSet = cluster.RegisterStmt(`
+INSERT INTO schema_versions (component, version)
+  VALUES (?, ?)
+  ON CONFLICT(component) DO UPDATE SET version = excluded.version
+`)
+
+// GetSchemaVersion returns the number of migrations applied for the component, 0 if none were.
+func GetSchemaVersion(ctx context.Context, tx *sql.Tx, component string) (int, error) {
+	stmt, err := prepareStmt(ctx, tx, schemaVersionByComponent)
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"schemaVersionByComponent\" prepared statement: %w", err)
+	}
+
+	var version int
+	err = stmt.QueryRowContext(ctx, component).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return -1, fmt.Errorf("Failed to get \"schema_versions\" entry: %w", err)
+	}
+
+	return version, nil
+}
+
+// setSchemaVersion records version as the number of migrations applied for the component.
+func setSchemaVersion(ctx context.Context, tx *sql.Tx, component string, version int) error {
+	stmt, err := prepareStmt(ctx, tx, schemaVersionSet)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"schemaVersionSet\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, component, version)
+	if err != nil {
+		return fmt.Errorf("Failed to set \"schema_versions\" entry: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyMigrations applies the pending migrations of the component in order and returns how many were applied.
+// Each migration runs in its own transaction together with the version bump, so an interrupted run resumes
+// from the first migration that was not committed. It is a no-op when the component is up to date and is
+// safe to call at every daemon start on every cluster member.
+func ApplyMigrations(ctx context.Context, transaction Transactor, component string, migrations []Migration) (int, error) {
+	applied := 0
+
+	for i := range migrations {
+		version := i + 1
+
+		// Only count the migration once its transaction is committed.
+		ran := false
+		err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			ran = false
+
+			current, err := GetSchemaVersion(ctx, tx, component)
+			if err != nil {
+				return err
+			}
+
+			// Already applied, possibly by another cluster member.
+			if current >= version {
+				return nil
+			}
+
+			err = migrations[i](ctx, tx)
+			if err != nil {
+				return fmt.Errorf("Failed to apply %q migration %d: %w", component, version, err)
+			}
+
+			err = setSchemaVersion(ctx, tx, component, version)
+			if err != nil {
+				return err
+			}
+
+			ran = true
+
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+
+		if ran {
+			applied++
+		}
+	}
+
+	if applied > 0 {
+		logger.Infof("Applied %d %q migrations", applied, component)
+		InvalidateStmts()
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// NodeBundle gathers a Node together with its services and the JujuUser registered for it.
+// Juju users are registered under the name of the node they belong to.
+type NodeBundle struct {
+	Node     Node
+	Services []string
+	JujuUser *JujuUser
+}
+
+var nodeBundleByName = cluster.RegisterStmt(fmt.Sprintf(`
+SELECT %s, %s
+  FROM nodes
+  JOIN internal_cluster_members ON nodes.member_id = internal_cluster_members.id
+  LEFT JOIN jujuuser ON jujuuser.username = nodes.name
+  WHERE ( nodes.name = ? )
+  ORDER BY jujuuser.id
+`, nodeColumns(), jujuUserColumns()))
+
+// GetNodeBundle returns the node with the given name along with its services and juju user in a single query.
+func GetNodeBundle(ctx context.Context, tx *sql.Tx, nodeName string) (*NodeBundle, error) {
+	stmt, err := prepareStmt(ctx, tx, nodeBundleByName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"nodeBundleByName\" prepared statement: %w", err)
+	}
+
+	var bundle *NodeBundle
+
+	dest := func(scan func(dest ...any) error) error {
+		n := Node{}
+		var userID, controllerID sql.NullInt64
+		var username, token, tokenKeyVersion, displayName, tokenMeta, tokenFingerprint sql.NullString
+		var createdAt, updatedAt sql.NullTime
+
+		err := scan(&n.ID, &n.Member, &n.Name, &n.Role, &n.MachineID, &n.SystemID, &userID, &username, &token, &controllerID, &createdAt, &updatedAt, &tokenKeyVersion, &displayName, &tokenMeta, &tokenFingerprint)
+		if err != nil {
+			return err
+		}
+
+		// The node is only repeated if its name is a username existing under several controllers.
+		if bundle != nil {
+			return ambiguousJujuUsernameError(username.String)
+		}
+
+		bundle = &NodeBundle{Node: n, Services: []string{}}
+		if userID.Valid {
+			plain, err := openToken(token.String, tokenKeyVersion.String)
+			unavailable := errors.Is(err, errTokenKeyUnavailable)
+			if err != nil && !unavailable {
+				return fmt.Errorf("Failed to read token of juju user %q: %w", username.String, err)
+			}
+
+			bundle.JujuUser = &JujuUser{
+				ID:               int(userID.Int64),
+				Username:         username.String,
+				Token:            plain,
+				TokenSet:         token.Valid,
+				TokenUnavailable: unavailable,
+				TokenKeyVersion:  tokenKeyVersion.String,
+				DisplayName:      displayName.String,
+				TokenMeta:        rawTokenMeta(tokenMeta),
+				TokenFingerprint: tokenFingerprint.String,
+				ControllerID:     controllerID.Int64,
+				CreatedAt:        createdAt.Time,
+				UpdatedAt:        updatedAt.Time,
+			}
+		}
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"nodes\" table: %w", err)
+	}
+
+	if bundle == nil {
+		return nil, api.StatusErrorf(http.StatusNotFound, "Node not found")
+	}
+
+	if bundle.Node.Role != "" {
+		err = json.Unmarshal([]byte(bundle.Node.Role), &bundle.Services)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal role: %w", err)
+		}
+	}
+
+	return bundle, nil
+}
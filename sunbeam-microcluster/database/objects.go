@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/canonical/lxd/lxd/db/query"
+)
+
+// ObjectScanner builds one object of type T from the columns of the current row, read with scan.
+type ObjectScanner[T any] func(scan func(dest ...any) error) (T, error)
+
+// GetObjects runs the prepared statement stmt with args and returns one object per row, built by scanObject.
+// It is the shared implementation of the getX helpers of entities.
+func GetObjects[T any](ctx context.Context, stmt *sql.Stmt, scanObject ObjectScanner[T], args ...any) ([]T, error) {
+	objects := make([]T, 0)
+
+	err := query.SelectObjects(ctx, stmt, objectsDest(&objects, scanObject), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// GetObjectsRaw runs the query string sql with args within tx and returns one object per row, built by scanObject.
+// It is the shared implementation of the getXRaw helpers of entities.
+func GetObjectsRaw[T any](ctx context.Context, tx *sql.Tx, sql string, scanObject ObjectScanner[T], args ...any) ([]T, error) {
+	objects := make([]T, 0)
+
+	err := query.Scan(ctx, tx, sql, objectsDest(&objects, scanObject), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// objectsDest returns a query.Dest appending the objects built by scanObject to objects.
+func objectsDest[T any](objects *[]T, scanObject ObjectScanner[T]) query.Dest {
+	return func(scan func(dest ...any) error) error {
+		object, err := scanObject(scan)
+		if err != nil {
+			return err
+		}
+
+		*objects = append(*objects, object)
+
+		return nil
+	}
+}
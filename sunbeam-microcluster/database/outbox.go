@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// OutboxRetention is how long processed outbox events are kept for replay.
+const OutboxRetention = 7 * 24 * time.Hour
+
+// OutboxEvent is a JujuUser change recorded for delivery to external systems.
+// The ID is monotonically increasing and doubles as the event sequence number.
+type OutboxEvent struct {
+	ID        int64
+	Username  string
+	Action    string
+	CreatedAt time.Time
+}
+
+var outboxEventCreate = cluster.RegisterStmt(`
+INSERT INTO jujuuser_outbox (username, action)
+  VALUES (?, ?)
+`)
+
+var outboxEventObjectsPending = cluster.RegisterStmt(`
+SELECT jujuuser_outbox.id, jujuuser_outbox.username, jujuuser_outbox.action, jujuuser_outbox.created_at
+  FROM jujuuser_outbox
+  WHERE jujuuser_outbox.processed = 0
+  ORDER BY jujuuser_outbox.id
+  LIMIT ?
+`)
+
+var outboxEventObjectsSince = cluster.RegisterStmt(`
+SELECT jujuuser_outbox.id, jujuuser_outbox.username, jujuuser_outbox.action, jujuuser_outbox.created_at
+  FROM jujuuser_outbox
+  WHERE jujuuser_outbox.id > ?
+  ORDER BY jujuuser_outbox.id
+  LIMIT ?
+`)
+
+// outboxOldestSequence is the sequence of the oldest retained event, or the next sequence once all were pruned.
+var outboxOldestSequence = cluster.RegisterStmt(`
+SELECT COALESCE(
+  (SELECT MIN(jujuuser_outbox.id) FROM jujuuser_outbox),
+  (SELECT sqlite_sequence.seq + 1 FROM sqlite_sequence WHERE sqlite_sequence.name = 'jujuuser_outbox'),
+  1)
+`)
+
+// outboxEventsPrune deletes the oldest events up to the first one that is unprocessed or within retention,
+// so the retained events always form a gapless tail of the sequence.
+var outboxEventsPrune = cluster.RegisterStmt(`
+DELETE FROM jujuuser_outbox
+  WHERE jujuuser_outbox.id < COALESCE(
+    (SELECT MIN(id) FROM jujuuser_outbox WHERE processed = 0 OR created_at >= datetime('now', ?)),
+    (SELECT MAX(id) + 1 FROM jujuuser_outbox))
+`)
+
+// appendOutboxEvent records a JujuUser change in the outbox as part of the caller's transaction.
+func appendOutboxEvent(ctx context.Context, tx *sql.Tx, action string, username string) error {
+	stmt, err := prepareStmt(ctx, tx, outboxEventCreate)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"outboxEventCreate\" prepared statement: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, username, action)
+	if err != nil {
+		return fmt.Errorf("Failed to create \"jujuuser_outbox\" entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingOutboxEvents returns up to limit unprocessed outbox events, oldest first.
+func GetPendingOutboxEvents(ctx context.Context, tx *sql.Tx, limit int) ([]OutboxEvent, error) {
+	stmt, err := prepareStmt(ctx, tx, outboxEventObjectsPending)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"outboxEventObjectsPending\" prepared statement: %w", err)
+	}
+
+	events := make([]OutboxEvent, 0)
+
+	dest := func(scan func(dest ...any) error) error {
+		e := OutboxEvent{}
+		err := scan(&e.ID, &e.Username, &e.Action, &e.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, e)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_outbox\" table: %w", err)
+	}
+
+	return events, nil
+}
+
+// MarkOutboxProcessed flags the outbox events with the given IDs as delivered.
+func MarkOutboxProcessed(ctx context.Context, tx *sql.Tx, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	stmt := fmt.Sprintf("UPDATE jujuuser_outbox SET processed = 1 WHERE id IN %s", query.Params(len(ids)))
+	_, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return fmt.Errorf("Failed to update \"jujuuser_outbox\" entries: %w", err)
+	}
+
+	return nil
+}
+
+// GetOutboxEventsSince returns up to limit outbox events with a sequence after since, in sequence order.
+// Processed events are included so that consumers can replay changes they missed. If events after since
+// were already pruned, a gone error is returned and the consumer has to resynchronize fully.
+func GetOutboxEventsSince(ctx context.Context, tx *sql.Tx, since int64, limit int) ([]OutboxEvent, error) {
+	stmt, err := prepareStmt(ctx, tx, outboxOldestSequence)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"outboxOldestSequence\" prepared statement: %w", err)
+	}
+
+	var oldest int64
+	err = stmt.QueryRowContext(ctx).Scan(&oldest)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get oldest \"jujuuser_outbox\" sequence: %w", err)
+	}
+
+	if since < oldest-1 {
+		return nil, api.StatusErrorf(http.StatusGone, "Events after %d are no longer retained, oldest is %d, resynchronize fully", since, oldest)
+	}
+
+	stmt, err = prepareStmt(ctx, tx, outboxEventObjectsSince)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get \"outboxEventObjectsSince\" prepared statement: %w", err)
+	}
+
+	events := make([]OutboxEvent, 0)
+
+	dest := func(scan func(dest ...any) error) error {
+		e := OutboxEvent{}
+		err := scan(&e.ID, &e.Username, &e.Action, &e.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, e)
+
+		return nil
+	}
+
+	err = query.SelectObjects(ctx, stmt, dest, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch from \"jujuuser_outbox\" table: %w", err)
+	}
+
+	return events, nil
+}
+
+// PruneOutboxEvents deletes the processed outbox events older than retention and returns how many were deleted.
+// Events are only pruned from the oldest end, an unprocessed event keeps all the ones after it.
+func PruneOutboxEvents(ctx context.Context, tx *sql.Tx, retention time.Duration) (int64, error) {
+	stmt, err := prepareStmt(ctx, tx, outboxEventsPrune)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"outboxEventsPrune\" prepared statement: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, fmt.Sprintf("-%d seconds", int64(retention.Seconds())))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to delete \"jujuuser_outbox\" entries: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Fetch affected rows: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// pendingOutboxEvents returns the unprocessed outbox events and fails the test on error.
+func pendingOutboxEvents(t *testing.T, db *sql.DB) []OutboxEvent {
+	t.Helper()
+
+	var events []OutboxEvent
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		events, err = GetPendingOutboxEvents(ctx, tx, 100)
+		return err
+	})
+
+	return events
+}
+
+func TestOutboxEventRolledBackWithChange(t *testing.T) {
+	db := newTestDB(t)
+
+	failure := errors.New("failure after create")
+	err := testTransaction(db)(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "alice", Token: "token"})
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the transaction to fail with %v, got %v", failure, err)
+	}
+
+	events := pendingOutboxEvents(t, db)
+	if len(events) != 0 {
+		t.Fatalf("Expected no outbox events after a rolled back create, got %+v", events)
+	}
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+
+	events = pendingOutboxEvents(t, db)
+	if len(events) != 1 {
+		t.Fatalf("Expected exactly one outbox event after a committed create, got %+v", events)
+	}
+
+	if events[0].Username != "alice" || events[0].Action != "create" {
+		t.Fatalf("Expected a create event for %q, got %+v", "alice", events[0])
+	}
+}
+
+func TestOutboxEventsMarkedProcessed(t *testing.T) {
+	db := newTestDB(t)
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "bob", Token: "token"})
+
+	events := pendingOutboxEvents(t, db)
+	if len(events) != 2 {
+		t.Fatalf("Expected two outbox events, got %+v", events)
+	}
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return MarkOutboxProcessed(ctx, tx, events[0].ID)
+	})
+
+	events = pendingOutboxEvents(t, db)
+	if len(events) != 1 || events[0].Username != "bob" {
+		t.Fatalf("Expected only the event for %q to be pending, got %+v", "bob", events)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/canonical/lxd/lxd/db/query"
+)
+
+// jujuUserExpectedColumns are the columns the jujuuser table has once all SchemaExtensions are applied.
+var jujuUserExpectedColumns = []string{
+	"id",
+	"username",
+	"token",
+	"controller_id",
+	"created_at",
+	"updated_at",
+	"token_key_version",
+	"display_name",
+	"last_used_at",
+	"token_meta",
+	"needs_provisioning",
+	"token_fingerprint",
+}
+
+// getTableColumns returns the names of the columns of table, empty if the table does not exist.
+func getTableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	columns := []string{}
+
+	dest := func(scan func(dest ...any) error) error {
+		var name string
+		err := scan(&name)
+		if err != nil {
+			return err
+		}
+
+		columns = append(columns, name)
+
+		return nil
+	}
+
+	err := query.Scan(ctx, tx, "SELECT name FROM pragma_table_info(?)", dest, table)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get columns of %q table: %w", table, err)
+	}
+
+	return columns, nil
+}
+
+// PostBootstrapCheck verifies that the jujuuser table exists with all its expected columns and, once it holds
+// juju users, that at least one of them has the admin role. Juju users are only added after bootstrap, so an
+// empty table is consistent.
+func PostBootstrapCheck(ctx context.Context, tx *sql.Tx) error {
+	columns, err := getTableColumns(ctx, tx, "jujuuser")
+	if err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		return fmt.Errorf("Table \"jujuuser\" is missing")
+	}
+
+	present := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		present[column] = true
+	}
+
+	missing := []string{}
+	for _, column := range jujuUserExpectedColumns {
+		if !present[column] {
+			missing = append(missing, column)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Table \"jujuuser\" is missing columns %s", strings.Join(missing, ", "))
+	}
+
+	stats, err := GetJujuUserStats(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if stats.Total == 0 {
+		return nil
+	}
+
+	admins, err := GetJujuUsersByRole(ctx, tx, JujuUserRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if len(admins) == 0 {
+		return fmt.Errorf("None of the %d juju users has the %q role", stats.Total, JujuUserRoleAdmin)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/canonical/lxd/lxd/db/schema"
 )
@@ -16,6 +17,25 @@ var SchemaExtensions = []schema.Update{
 	JujuUserSchemaUpdate,
 	ManifestsSchemaUpdate,
 	AddSystemIDToNodes,
+	JujuUserLabelsSchemaUpdate,
+	JujuUserControllersSchemaUpdate,
+	JujuUserOutboxSchemaUpdate,
+	SchemaVersionsSchemaUpdate,
+	AddTimestampsToJujuUser,
+	AddTokenKeyVersionToJujuUser,
+	AddDisplayNameToJujuUser,
+	JujuUserRolesSchemaUpdate,
+	JujuUserDeleteIntentsSchemaUpdate,
+	AddLastUsedAtToJujuUser,
+	JujuUserUsernameCollationSchemaUpdate,
+	AddTokenMetaToJujuUser,
+	JujuUserDeadLettersSchemaUpdate,
+	JujuUserLifetimeStatsSchemaUpdate,
+	AddNeedsProvisioningToJujuUser,
+	AddTokenFingerprintToJujuUser,
+	JujuUserRotationPlansSchemaUpdate,
+	JujuUserHistorySchemaUpdate,
+	AddMergedFromToJujuUserHistory,
 }
 
 // NodesSchemaUpdate is schema for table nodes
@@ -96,3 +116,354 @@ ALTER TABLE nodes ADD COLUMN system_id TEXT default '';
 
 	return err
 }
+
+// JujuUserLabelsSchemaUpdate is schema for table jujuuser_labels
+func JujuUserLabelsSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_labels (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  jujuuser_id                   INTEGER  NOT  NULL,
+  key                           TEXT     NOT  NULL,
+  value                         TEXT     NOT  NULL,
+  FOREIGN KEY (jujuuser_id) REFERENCES "jujuuser" (id) ON DELETE CASCADE,
+  UNIQUE(jujuuser_id, key)
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserControllersSchemaUpdate adds table jujucontrollers and a controller to every jujuuser entry.
+// Existing juju users are assigned to the default controller, and usernames are now only unique per controller.
+// Foreign keys are enforced during schema extensions, so dropping table jujuuser deletes the jujuuser_labels
+// entries referencing it: they are set aside and restored once the new table is in place.
+func JujuUserControllersSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujucontrollers (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  name                          TEXT     NOT  NULL,
+  UNIQUE(name)
+);
+INSERT INTO jujucontrollers (id, name) VALUES (1, 'default');
+CREATE TABLE jujuuser_new (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  username                      TEXT     NOT  NULL,
+  token                         TEXT     NOT  NULL,
+  controller_id                 INTEGER  NOT  NULL DEFAULT 1,
+  FOREIGN KEY (controller_id) REFERENCES "jujucontrollers" (id)
+  UNIQUE(controller_id, username)
+);
+INSERT INTO jujuuser_new (id, username, token, controller_id)
+  SELECT id, username, token, 1 FROM jujuuser;
+CREATE TABLE jujuuser_labels_backup AS
+  SELECT id, jujuuser_id, key, value FROM jujuuser_labels;
+DROP TABLE jujuuser;
+ALTER TABLE jujuuser_new RENAME TO jujuuser;
+INSERT INTO jujuuser_labels (id, jujuuser_id, key, value)
+  SELECT id, jujuuser_id, key, value FROM jujuuser_labels_backup;
+DROP TABLE jujuuser_labels_backup;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserOutboxSchemaUpdate is schema for table jujuuser_outbox
+func JujuUserOutboxSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_outbox (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  username                      TEXT     NOT  NULL,
+  action                        TEXT     NOT  NULL,
+  created_at                    DATETIME NOT  NULL DEFAULT CURRENT_TIMESTAMP,
+  processed                     INTEGER  NOT  NULL DEFAULT 0
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// SchemaVersionsSchemaUpdate is schema for table schema_versions
+func SchemaVersionsSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE schema_versions (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  component                     TEXT     NOT  NULL,
+  version                       INTEGER  NOT  NULL,
+  UNIQUE(component)
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddTimestampsToJujuUser is schema update for table jujuuser
+// Existing entries are stamped with the time of the update.
+func AddTimestampsToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN created_at DATETIME;
+ALTER TABLE jujuuser ADD COLUMN updated_at DATETIME;
+UPDATE jujuuser SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddTokenKeyVersionToJujuUser is schema update for table jujuuser
+func AddTokenKeyVersionToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN token_key_version TEXT NOT NULL default '';
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddDisplayNameToJujuUser is schema update for table jujuuser
+func AddDisplayNameToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN display_name TEXT;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserRolesSchemaUpdate is schema for table jujuuser_roles
+func JujuUserRolesSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_roles (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  jujuuser_id                   INTEGER  NOT  NULL,
+  role                          TEXT     NOT  NULL,
+  FOREIGN KEY (jujuuser_id) REFERENCES "jujuuser" (id) ON DELETE CASCADE,
+  UNIQUE(jujuuser_id, role)
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserDeleteIntentsSchemaUpdate is schema for table jujuuser_delete_intents
+func JujuUserDeleteIntentsSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_delete_intents (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  token                         TEXT     NOT  NULL,
+  username                      TEXT     NOT  NULL,
+  services                      TEXT     NOT  NULL,
+  expires_at                    DATETIME NOT  NULL,
+  UNIQUE(token)
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddLastUsedAtToJujuUser is schema update for table jujuuser
+func AddLastUsedAtToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN last_used_at DATETIME;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserUsernameCollationSchemaUpdate recreates table jujuuser with the username collation chosen with
+// SetUsernameCollation. Binary is the collation the column already has, so nothing changes unless
+// case insensitive usernames were requested when bootstrapping.
+// The collation is a setting of the member running the update rather than part of the schema, so it is only
+// applied to brand-new databases: the update fails if table jujuuser already holds users.
+// As with JujuUserControllersSchemaUpdate, the jujuuser_labels and jujuuser_roles entries are set aside
+// around the rebuild so that dropping table jujuuser does not delete them.
+func JujuUserUsernameCollationSchemaUpdate(ctx context.Context, tx *sql.Tx) error {
+	collation := currentUsernameCollation()
+	if collation == UsernameCollationBinary {
+		return nil
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM jujuuser").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("Failed to count \"jujuuser\" entries: %w", err)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("Username collation %q can only be chosen for a new database, table \"jujuuser\" already has %d entries", collation, count)
+	}
+
+	stmt := fmt.Sprintf(`
+CREATE TABLE jujuuser_new (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  username                      TEXT     NOT  NULL COLLATE %s,
+  token                         TEXT     NOT  NULL,
+  controller_id                 INTEGER  NOT  NULL DEFAULT 1,
+  created_at                    DATETIME,
+  updated_at                    DATETIME,
+  token_key_version             TEXT     NOT  NULL default '',
+  display_name                  TEXT,
+  last_used_at                  DATETIME,
+  FOREIGN KEY (controller_id) REFERENCES "jujucontrollers" (id)
+  UNIQUE(controller_id, username)
+);
+INSERT INTO jujuuser_new (id, username, token, controller_id, created_at, updated_at, token_key_version, display_name, last_used_at)
+  SELECT id, username, token, controller_id, created_at, updated_at, token_key_version, display_name, last_used_at FROM jujuuser;
+CREATE TABLE jujuuser_labels_backup AS
+  SELECT id, jujuuser_id, key, value FROM jujuuser_labels;
+CREATE TABLE jujuuser_roles_backup AS
+  SELECT id, jujuuser_id, role FROM jujuuser_roles;
+DROP TABLE jujuuser;
+ALTER TABLE jujuuser_new RENAME TO jujuuser;
+INSERT INTO jujuuser_labels (id, jujuuser_id, key, value)
+  SELECT id, jujuuser_id, key, value FROM jujuuser_labels_backup;
+INSERT INTO jujuuser_roles (id, jujuuser_id, role)
+  SELECT id, jujuuser_id, role FROM jujuuser_roles_backup;
+DROP TABLE jujuuser_labels_backup;
+DROP TABLE jujuuser_roles_backup;
+  `, collation)
+
+	_, err = tx.ExecContext(ctx, stmt)
+
+	return err
+}
+
+// AddTokenMetaToJujuUser is schema update for table jujuuser
+func AddTokenMetaToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN token_meta TEXT;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserDeadLettersSchemaUpdate counts the delivery attempts of jujuuser_outbox events and adds table jujuuser_dead_letters
+func JujuUserDeadLettersSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser_outbox ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE jujuuser_dead_letters (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  event_id                      INTEGER  NOT  NULL,
+  username                      TEXT     NOT  NULL,
+  action                        TEXT     NOT  NULL,
+  created_at                    DATETIME NOT  NULL,
+  failed_at                     DATETIME NOT  NULL,
+  attempts                      INTEGER  NOT  NULL,
+  last_error                    TEXT     NOT  NULL
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserLifetimeStatsSchemaUpdate is schema for table jujuuser_lifetime_stats
+// Existing juju users are counted as created.
+func JujuUserLifetimeStatsSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_lifetime_stats (
+  id                            INTEGER  PRIMARY KEY NOT NULL,
+  created                       INTEGER  NOT  NULL DEFAULT 0,
+  deleted                       INTEGER  NOT  NULL DEFAULT 0
+);
+INSERT INTO jujuuser_lifetime_stats (id, created, deleted)
+  SELECT 1, COUNT(*), 0 FROM jujuuser;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddNeedsProvisioningToJujuUser is schema update for table jujuuser
+// The flag is backfilled by the BackfillJujuUserNeedsProvisioning migration.
+func AddNeedsProvisioningToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN needs_provisioning INTEGER NOT NULL DEFAULT 0;
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddTokenFingerprintToJujuUser is schema update for table jujuuser
+// The fingerprints are backfilled by the BackfillJujuUserTokenFingerprints migration.
+// The index serves both the exact and the prefix fingerprint lookups.
+func AddTokenFingerprintToJujuUser(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser ADD COLUMN token_fingerprint TEXT NOT NULL DEFAULT '';
+CREATE INDEX jujuuser_token_fingerprint ON jujuuser (token_fingerprint);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserRotationPlansSchemaUpdate is schema for table jujuuser_rotation_plans
+func JujuUserRotationPlansSchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_rotation_plans (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  plan_id                       TEXT     NOT  NULL,
+  applied_at                    DATETIME NOT  NULL,
+  rotated                       INTEGER  NOT  NULL,
+  UNIQUE(plan_id)
+);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// JujuUserHistorySchemaUpdate is schema for table jujuuser_history
+func JujuUserHistorySchemaUpdate(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+CREATE TABLE jujuuser_history (
+  id                            INTEGER  PRIMARY KEY AUTOINCREMENT NOT NULL,
+  username                      TEXT     NOT  NULL,
+  action                        TEXT     NOT  NULL,
+  old_token_fingerprint         TEXT     NOT  NULL DEFAULT '',
+  new_token_fingerprint         TEXT     NOT  NULL DEFAULT '',
+  created_at                    DATETIME NOT  NULL,
+  actor                         TEXT     NOT  NULL
+);
+CREATE INDEX jujuuser_history_username ON jujuuser_history (username);
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
+
+// AddMergedFromToJujuUserHistory is schema update for table jujuuser_history
+func AddMergedFromToJujuUserHistory(_ context.Context, tx *sql.Tx) error {
+	stmt := `
+ALTER TABLE jujuuser_history ADD COLUMN merged_from TEXT NOT NULL DEFAULT '';
+  `
+
+	_, err := tx.Exec(stmt)
+
+	return err
+}
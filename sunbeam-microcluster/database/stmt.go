@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/canonical/microcluster/cluster"
+)
+
+// stmtsInvalidated is set once the schema changed underneath the statements prepared at daemon startup.
+var stmtsInvalidated atomic.Bool
+
+// InvalidateStmts marks the statements prepared at daemon startup as stale.
+// It must be called after a schema migration applied while the daemon is running, so that
+// statements are re-prepared against the new schema instead of failing until the next restart.
+func InvalidateStmts() {
+	stmtsInvalidated.Store(true)
+}
+
+// prepareStmt returns the registered statement with the given code for use within tx.
+// Once InvalidateStmts has been called the statement is prepared again on the transaction
+// from its registered SQL text rather than taken from the startup cache. The same happens for
+// statements missing from the cache, such as those registered after the daemon prepared its statements.
+func prepareStmt(ctx context.Context, tx *sql.Tx, code int) (*sql.Stmt, error) {
+	if !stmtsInvalidated.Load() {
+		stmt, err := cluster.Stmt(tx, code)
+		if err == nil {
+			return stmt, nil
+		}
+	}
+
+	stmt, err := cluster.StmtString(code)
+	if err != nil {
+		return nil, err
+	}
+
+	preparedStmt, err := tx.PrepareContext(ctx, stmt)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to prepare statement %d: %w", code, err)
+	}
+
+	return preparedStmt, nil
+}
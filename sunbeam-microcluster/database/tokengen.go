@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+)
+
+// TokenGenerator mints the tokens of JujuUsers created or rotated by the daemon itself.
+type TokenGenerator interface {
+	GenerateToken(username string) (string, error)
+}
+
+// TokenGeneratorFunc adapts a function to the TokenGenerator interface.
+type TokenGeneratorFunc func(username string) (string, error)
+
+// GenerateToken calls f.
+func (f TokenGeneratorFunc) GenerateToken(username string) (string, error) {
+	return f(username)
+}
+
+// RandomTokenGenerator generates URL safe tokens from 32 random bytes, which can be used as macaroon secrets.
+type RandomTokenGenerator struct{}
+
+// GenerateToken returns a random token, regardless of username.
+func (RandomTokenGenerator) GenerateToken(_ string) (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate token: %w", err)
+	}
+
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+// GenerateAndCreateJujuUser adds a new JujuUser with the given username to the database like CreateJujuUser,
+// with a token produced by gen. It returns the created JujuUser, whose Token is the plain generated token.
+func GenerateAndCreateJujuUser(ctx context.Context, tx *sql.Tx, username string, gen TokenGenerator) (*JujuUser, error) {
+	token, err := gen.GenerateToken(username)
+	if err != nil {
+		return nil, err
+	}
+
+	object := JujuUser{Username: username, Token: token, TokenSet: true, ControllerID: DefaultJujuControllerID}
+
+	id, err := CreateJujuUser(ctx, tx, object)
+	if err != nil {
+		return nil, err
+	}
+
+	object.ID = int(id)
+
+	return &object, nil
+}
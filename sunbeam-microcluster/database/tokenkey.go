@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/cluster"
+)
+
+// tokenKey is the key JujuUser tokens are encrypted with, tokens are stored in plain text when unset.
+var tokenKey []byte
+var tokenKeyMu sync.RWMutex
+
+// tokenKeyUnavailable is set when the configured key could not be loaded, see SetTokenKeyUnavailable.
+var tokenKeyUnavailable bool
+
+// SetTokenEncryptionKey sets the 32 bytes AES key used to encrypt JujuUser tokens at rest.
+// A nil key disables encryption of newly written tokens.
+func SetTokenEncryptionKey(key []byte) error {
+	if key != nil && len(key) != 32 {
+		return fmt.Errorf("Token encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	tokenKeyMu.Lock()
+	defer tokenKeyMu.Unlock()
+
+	tokenKey = key
+	tokenKeyUnavailable = false
+
+	return nil
+}
+
+// SetTokenKeyUnavailable switches to degraded mode, for when the token encryption key is configured but could
+// not be loaded. Encrypted tokens then read as unavailable rather than failing the whole read, see
+// JujuUser.TokenErr, so that usernames can still be listed and counted. Tokens can't be written, as storing
+// them in plain text would silently disable encryption.
+func SetTokenKeyUnavailable() {
+	tokenKeyMu.Lock()
+	defer tokenKeyMu.Unlock()
+
+	tokenKey = nil
+	tokenKeyUnavailable = true
+}
+
+// TokenKeyUnavailable returns whether the daemon runs in degraded mode, see SetTokenKeyUnavailable.
+func TokenKeyUnavailable() bool {
+	tokenKeyMu.RLock()
+	defer tokenKeyMu.RUnlock()
+
+	return tokenKeyUnavailable
+}
+
+// errTokenKeyUnavailable is returned for the encrypted tokens read or the tokens written in degraded mode.
+var errTokenKeyUnavailable = api.StatusErrorf(http.StatusServiceUnavailable, "Token unavailable, encryption key missing")
+
+// TokenErr returns a service unavailable error if the token of the JujuUser could not be decrypted because
+// the encryption key is missing, in which case Token is empty.
+func (j JujuUser) TokenErr() error {
+	if j.TokenUnavailable {
+		return errTokenKeyUnavailable
+	}
+
+	return nil
+}
+
+// currentTokenKey returns the key configured with SetTokenEncryptionKey.
+func currentTokenKey() []byte {
+	tokenKeyMu.RLock()
+	defer tokenKeyMu.RUnlock()
+
+	return tokenKey
+}
+
+// tokenKeyVersion identifies a key without revealing it. Plain text tokens have an empty version.
+func tokenKeyVersion(key []byte) string {
+	if key == nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// encryptToken encrypts token with key using AES-GCM.
+func encryptToken(key []byte, token string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// decryptToken decrypts a token encrypted by encryptToken with the same key.
+func decryptToken(key []byte, encrypted string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("Encrypted token is too short")
+	}
+
+	token, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(token), nil
+}
+
+// sealToken returns the value to store for token along with its key version.
+func sealToken(token string) (string, string, error) {
+	if TokenKeyUnavailable() {
+		return "", "", errTokenKeyUnavailable
+	}
+
+	key := currentTokenKey()
+	if key == nil {
+		return token, "", nil
+	}
+
+	encrypted, err := encryptToken(key, token)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to encrypt token: %w", err)
+	}
+
+	return encrypted, tokenKeyVersion(key), nil
+}
+
+// openToken returns the plain text of a stored token.
+func openToken(stored string, version string) (string, error) {
+	if version == "" {
+		return stored, nil
+	}
+
+	if TokenKeyUnavailable() {
+		return "", errTokenKeyUnavailable
+	}
+
+	key := currentTokenKey()
+	if tokenKeyVersion(key) != version {
+		return "", fmt.Errorf("Token is encrypted with unknown key version %q", version)
+	}
+
+	return decryptToken(key, stored)
+}
+
+var jujuUserTokenRekey = cluster.RegisterStmt(`
+UPDATE jujuuser
+  SET token = ?, token_key_version = ?
+ WHERE id = ?
+`)
+
+var jujuUserTokensNotOnKeyCount = cluster.RegisterStmt(`
+SELECT COUNT(*) FROM jujuuser
+  WHERE jujuuser.token IS NOT NULL AND jujuuser.token_key_version != ?
+`)
+
+// ResealJujuUserTokens encrypts with the key set with SetTokenEncryptionKey every JujuUser token not encrypted
+// with it yet, such as the tokens stored before encryption was enabled, and returns how many it encrypted.
+// Nothing happens when no key is set. Like RotateEncryptionKey it can simply be run again if interrupted.
+func ResealJujuUserTokens(ctx context.Context, tx *sql.Tx) (int, error) {
+	key := currentTokenKey()
+	if key == nil {
+		return 0, nil
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokensNotOnKeyCount)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get \"jujuUserTokensNotOnKeyCount\" prepared statement: %w", err)
+	}
+
+	var count int
+	err = stmt.QueryRowContext(ctx, tokenKeyVersion(key)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to count \"jujuuser\" entries to encrypt: %w", err)
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	err = RotateEncryptionKey(ctx, tx, key, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RotateEncryptionKey re-encrypts all JujuUser tokens from oldKey to newKey within tx.
+// Plain text tokens are encrypted too. Tokens already on newKey are skipped, so an interrupted rotation
+// can simply be run again. Once committed, newKey must be set with SetTokenEncryptionKey.
+func RotateEncryptionKey(ctx context.Context, tx *sql.Tx, oldKey []byte, newKey []byte) error {
+	if len(newKey) != 32 {
+		return fmt.Errorf("Token encryption key must be 32 bytes, got %d", len(newKey))
+	}
+
+	oldVersion := tokenKeyVersion(oldKey)
+	newVersion := tokenKeyVersion(newKey)
+
+	type storedToken struct {
+		id      int
+		token   string
+		version string
+	}
+
+	tokens := []storedToken{}
+
+	dest := func(scan func(dest ...any) error) error {
+		t := storedToken{}
+		var token sql.NullString
+		err := scan(&t.id, &token, &t.version)
+		if err != nil {
+			return err
+		}
+
+		// Rows without a token have nothing to encrypt.
+		if token.Valid {
+			t.token = token.String
+			tokens = append(tokens, t)
+		}
+
+		return nil
+	}
+
+	err := query.Scan(ctx, tx, "SELECT jujuuser.id, jujuuser.token, jujuuser.token_key_version FROM jujuuser", dest)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch from \"jujuuser\" table: %w", err)
+	}
+
+	stmt, err := prepareStmt(ctx, tx, jujuUserTokenRekey)
+	if err != nil {
+		return fmt.Errorf("Failed to get \"jujuUserTokenRekey\" prepared statement: %w", err)
+	}
+
+	for _, t := range tokens {
+		if t.version == newVersion {
+			continue
+		}
+
+		plain := t.token
+		if t.version != "" {
+			if t.version != oldVersion {
+				return fmt.Errorf("Token of \"jujuuser\" entry %d is encrypted with unknown key version %q", t.id, t.version)
+			}
+
+			plain, err = decryptToken(oldKey, t.token)
+			if err != nil {
+				return fmt.Errorf("Failed to decrypt token of \"jujuuser\" entry %d: %w", t.id, err)
+			}
+		}
+
+		encrypted, err := encryptToken(newKey, plain)
+		if err != nil {
+			return fmt.Errorf("Failed to encrypt token of \"jujuuser\" entry %d: %w", t.id, err)
+		}
+
+		_, err = stmt.ExecContext(ctx, encrypted, newVersion, t.id)
+		if err != nil {
+			return fmt.Errorf("Update \"jujuuser\" entry failed: %w", err)
+		}
+	}
+
+	return nil
+}
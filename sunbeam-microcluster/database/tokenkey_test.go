@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+// withTokenEncryptionKey sets key as the token encryption key for the duration of the test.
+func withTokenEncryptionKey(t *testing.T, key []byte) {
+	t.Helper()
+
+	err := SetTokenEncryptionKey(key)
+	if err != nil {
+		t.Fatalf("Failed to set token encryption key: %v", err)
+	}
+
+	t.Cleanup(func() { _ = SetTokenEncryptionKey(nil) })
+}
+
+func TestJujuUserTokensUnavailableWithoutKey(t *testing.T) {
+	db := newTestDB(t)
+	withTokenEncryptionKey(t, make([]byte, 32))
+
+	mustCreateJujuUser(t, db, JujuUser{Username: "alice", Token: "token-1"})
+	mustCreateJujuUser(t, db, JujuUser{Username: "bob", Token: "token-2"})
+
+	SetTokenKeyUnavailable()
+
+	mustTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		usernames, err := ListJujuUsernames(ctx, tx)
+		if err != nil {
+			t.Fatalf("Failed to list usernames in degraded mode: %v", err)
+		}
+
+		if len(usernames) != 2 {
+			t.Fatalf("Expected 2 usernames, got %v", usernames)
+		}
+
+		users, err := GetJujuUsers(ctx, tx)
+		if err != nil {
+			t.Fatalf("Failed to list juju users in degraded mode: %v", err)
+		}
+
+		for _, user := range users {
+			if !user.TokenUnavailable || user.Token != "" {
+				t.Errorf("Expected the token of %q to be unavailable, got %q", user.Username, user.Token)
+			}
+
+			assertStatus(t, user.TokenErr(), http.StatusServiceUnavailable)
+		}
+
+		_, err = GetJujuUserToken(ctx, tx, "alice")
+		assertStatus(t, err, http.StatusServiceUnavailable)
+
+		return nil
+	})
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the JujuUser operations with the global tracer provider, which does nothing
+// until one is set with otel.SetTracerProvider.
+var tracer = otel.Tracer("github.com/canonical/snap-openstack/sunbeam-microcluster/database")
+
+// jujuUserSpan is the span of a JujuUser operation.
+type jujuUserSpan struct {
+	span trace.Span
+}
+
+// startJujuUserSpan starts the span of the JujuUser operation, as a child of the span carried by ctx if any,
+// and returns the context carrying it. Usernames aren't sensitive and are recorded unless empty, tokens never are.
+func startJujuUserSpan(ctx context.Context, operation string, username string) (context.Context, jujuUserSpan) {
+	attributes := []attribute.KeyValue{attribute.String("jujuuser.operation", operation)}
+	if username != "" {
+		attributes = append(attributes, attribute.String("jujuuser.username", username))
+	}
+
+	ctx, span := tracer.Start(ctx, "jujuuser."+operation, trace.WithAttributes(attributes...))
+
+	return ctx, jujuUserSpan{span: span}
+}
+
+// End ends the span, recording err as its error status if set.
+func (s jujuUserSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+
+	s.span.End()
+}
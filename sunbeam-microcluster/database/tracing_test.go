@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordedSpan is a span ended through the recordingTracerProvider.
+type recordedSpan struct {
+	name       string
+	attributes map[attribute.Key]string
+	status     codes.Code
+}
+
+// recordingTracerProvider records the spans ended by its tracers, it does not propagate them.
+type recordingTracerProvider struct {
+	noop.TracerProvider
+
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+// Tracer returns a tracer recording its spans in p.
+func (p *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p}
+}
+
+// reset drops the recorded spans now and when the test ends.
+func (p *recordingTracerProvider) reset(t *testing.T) {
+	p.mu.Lock()
+	p.spans = nil
+	p.mu.Unlock()
+
+	t.Cleanup(func() {
+		p.mu.Lock()
+		p.spans = nil
+		p.mu.Unlock()
+	})
+}
+
+// ended returns the spans ended so far.
+func (p *recordingTracerProvider) ended() []recordedSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]recordedSpan(nil), p.spans...)
+}
+
+type recordingTracer struct {
+	noop.Tracer
+
+	provider *recordingTracerProvider
+}
+
+// Start starts a span recorded in the provider once ended.
+func (r recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordingSpan{provider: r.provider, recorded: recordedSpan{name: name, attributes: map[attribute.Key]string{}}}
+	config := trace.NewSpanStartConfig(opts...)
+	for _, kv := range config.Attributes() {
+		span.recorded.attributes[kv.Key] = kv.Value.Emit()
+	}
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	noop.Span
+
+	provider *recordingTracerProvider
+	recorded recordedSpan
+}
+
+// SetStatus records the status of the span.
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+	s.recorded.status = code
+}
+
+// End records the span in its provider.
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+
+	s.provider.spans = append(s.provider.spans, s.recorded)
+}
+
+// testTracerProvider records the spans of the package tracer. The global tracer provider can only be
+// delegated to once, so it is installed once for all the tests.
+var testTracerProvider = &recordingTracerProvider{}
+
+var installTestTracerProvider sync.Once
+
+// recordSpans makes the package tracer record its spans in testTracerProvider, emptied for the test.
+func recordSpans(t *testing.T) *recordingTracerProvider {
+	installTestTracerProvider.Do(func() { otel.SetTracerProvider(testTracerProvider) })
+	testTracerProvider.reset(t)
+
+	return testTracerProvider
+}
+
+func TestJujuUserOperationSpans(t *testing.T) {
+	db := newTestDB(t)
+	provider := recordSpans(t)
+
+	for _, test := range []struct {
+		operation string
+		username  string
+		run       func(ctx context.Context, tx *sql.Tx) error
+		status    codes.Code
+	}{
+		{
+			operation: "create",
+			username:  "alice",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := CreateJujuUser(ctx, tx, JujuUser{Username: "alice", Token: "token"})
+				return err
+			},
+		},
+		{
+			operation: "get",
+			username:  "alice",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := GetJujuUser(ctx, tx, "alice")
+				return err
+			},
+		},
+		{
+			operation: "update",
+			username:  "alice",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				return UpdateJujuUser(ctx, tx, "alice", JujuUser{Username: "alice", Token: "new-token"})
+			},
+		},
+		{
+			operation: "list",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := GetJujuUsers(ctx, tx)
+				return err
+			},
+		},
+		{
+			operation: "delete",
+			username:  "alice",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				return DeleteJujuUser(ctx, tx, "alice")
+			},
+		},
+		{
+			operation: "get",
+			username:  "alice",
+			run: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := GetJujuUser(ctx, tx, "alice")
+				return err
+			},
+			status: codes.Error,
+		},
+	} {
+		provider.reset(t)
+
+		err := testTransaction(db)(context.Background(), test.run)
+		if (err != nil) != (test.status == codes.Error) {
+			t.Fatalf("Unexpected result of the %s of %q: %v", test.operation, test.username, err)
+		}
+
+		spans := provider.ended()
+		if len(spans) != 1 {
+			names := make([]string, 0, len(spans))
+			for _, span := range spans {
+				names = append(names, span.name)
+			}
+
+			t.Fatalf("Expected one span for the %s of %q, got %v", test.operation, test.username, names)
+		}
+
+		span := spans[0]
+		if span.name != "jujuuser."+test.operation {
+			t.Fatalf("Expected a span named %q, got %q", "jujuuser."+test.operation, span.name)
+		}
+
+		if span.attributes["jujuuser.operation"] != test.operation {
+			t.Fatalf("Expected the %q span to record its operation, got %v", span.name, span.attributes)
+		}
+
+		username, ok := span.attributes["jujuuser.username"]
+		if username != test.username || ok != (test.username != "") {
+			t.Fatalf("Expected the %q span to record the username %q, got %v", span.name, test.username, span.attributes)
+		}
+
+		if span.status != test.status {
+			t.Fatalf("Expected the %q span to have status %v, got %v", span.name, test.status, span.status)
+		}
+	}
+}
@@ -54,6 +54,10 @@ func GetConfigItemKeys(s *state.State, prefix *string) ([]string, error) {
 
 // CreateConfig adds a new ConfigItem to the database
 func CreateConfig(s *state.State, key string, value string) error {
+	err := validateConfig(key, value)
+	if err != nil {
+		return err
+	}
 
 	return s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
 		_, err := database.CreateConfigItem(ctx, tx, database.ConfigItem{Key: key, Value: value})
@@ -65,11 +69,24 @@ func CreateConfig(s *state.State, key string, value string) error {
 }
 
 // UpdateConfig updates a ConfigItem in the database
+// The value is validated against the schema registered for the key, and the watchers of the key are
+// notified once the change is committed.
 func UpdateConfig(s *state.State, key string, value string) error {
+	err := validateConfig(key, value)
+	if err != nil {
+		return err
+	}
+
 	configItem := database.ConfigItem{Key: key, Value: value}
+	changed := true
 
-	return s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
-		err := database.UpdateConfigItem(ctx, tx, key, configItem)
+	err = s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := database.GetConfigItem(ctx, tx, key)
+		if err == nil {
+			changed = current.Value != value
+		}
+
+		err = database.UpdateConfigItem(ctx, tx, key, configItem)
 		if err != nil && strings.Contains(err.Error(), "ConfigItem not found") {
 			_, err = database.CreateConfigItem(ctx, tx, configItem)
 		}
@@ -79,6 +96,15 @@ func UpdateConfig(s *state.State, key string, value string) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		notifyConfigWatchers(s, key, value)
+	}
+
+	return nil
 }
 
 // DeleteConfig deletes a ConfigItem from the database
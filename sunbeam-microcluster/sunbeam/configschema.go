@@ -0,0 +1,130 @@
+package sunbeam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/lxd/shared/logger"
+	"github.com/canonical/microcluster/state"
+)
+
+// JSON types a config value can be required to have.
+const (
+	ConfigTypeString  = "string"
+	ConfigTypeInteger = "integer"
+	ConfigTypeNumber  = "number"
+	ConfigTypeBoolean = "boolean"
+	ConfigTypeObject  = "object"
+	ConfigTypeArray   = "array"
+)
+
+// ConfigKeySchema describes the value expected for a config key.
+type ConfigKeySchema struct {
+	// Type is the JSON type of the value, one of the ConfigType constants.
+	Type string
+}
+
+// ConfigWatcher is called with the new value of a watched config key after it changed.
+type ConfigWatcher func(s *state.State, key string, value string)
+
+// configSchemas maps the config namespaces with a registered schema to the schema of each of their keys.
+var configSchemas = map[string]map[string]ConfigKeySchema{}
+
+// configWatchers maps the watched config keys to their watchers.
+var configWatchers = map[string][]ConfigWatcher{}
+var configSchemaMu sync.RWMutex
+
+// RegisterConfigSchema registers the schema of the config keys under namespace, which are the keys starting
+// with namespace followed by a dot. Once registered, setting a key of the namespace missing from keys or with
+// a value of the wrong type is rejected. Keys outside of any registered namespace are stored as is.
+func RegisterConfigSchema(namespace string, keys map[string]ConfigKeySchema) {
+	configSchemaMu.Lock()
+	defer configSchemaMu.Unlock()
+
+	configSchemas[namespace] = keys
+}
+
+// WatchConfig registers watcher to be called whenever the value of key is changed through UpdateConfig.
+func WatchConfig(key string, watcher ConfigWatcher) {
+	configSchemaMu.Lock()
+	defer configSchemaMu.Unlock()
+
+	configWatchers[key] = append(configWatchers[key], watcher)
+}
+
+// validateConfig checks value against the registered schema of key, it returns a 400 StatusError if the key is
+// unknown to its namespace or value does not have the expected type.
+func validateConfig(key string, value string) error {
+	namespace, _, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil
+	}
+
+	configSchemaMu.RLock()
+	defer configSchemaMu.RUnlock()
+
+	keys, ok := configSchemas[namespace]
+	if !ok {
+		return nil
+	}
+
+	schema, ok := keys[key]
+	if !ok {
+		return api.StatusErrorf(http.StatusBadRequest, "Unknown config key %q", key)
+	}
+
+	var decoded any
+	err := json.Unmarshal([]byte(value), &decoded)
+	if err != nil {
+		return api.StatusErrorf(http.StatusBadRequest, "Invalid value for config key %q: %v", key, err)
+	}
+
+	if !configValueHasType(decoded, schema.Type) {
+		return api.StatusErrorf(http.StatusBadRequest, "Invalid value for config key %q: expected %s", key, schema.Type)
+	}
+
+	return nil
+}
+
+// configValueHasType reports whether the decoded JSON value is of the given ConfigType.
+func configValueHasType(value any, valueType string) bool {
+	switch v := value.(type) {
+	case string:
+		return valueType == ConfigTypeString
+	case float64:
+		return valueType == ConfigTypeNumber || (valueType == ConfigTypeInteger && v == float64(int64(v)))
+	case bool:
+		return valueType == ConfigTypeBoolean
+	case map[string]any:
+		return valueType == ConfigTypeObject
+	case []any:
+		return valueType == ConfigTypeArray
+	default:
+		return false
+	}
+}
+
+// notifyConfigWatchers calls the watchers of key with its new value.
+func notifyConfigWatchers(s *state.State, key string, value string) {
+	configSchemaMu.RLock()
+	watchers := append([]ConfigWatcher{}, configWatchers[key]...)
+	configSchemaMu.RUnlock()
+
+	for _, watcher := range watchers {
+		func() {
+			// A failing subsystem must not fail the config update that already committed.
+			defer func() {
+				r := recover()
+				if r != nil {
+					logger.Error("Config watcher failed", logger.Ctx{"key": key, "err": fmt.Sprint(r)})
+				}
+			}()
+
+			watcher(s, key, value)
+		}()
+	}
+}
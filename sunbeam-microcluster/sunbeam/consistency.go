@@ -0,0 +1,130 @@
+package sunbeam
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/state"
+)
+
+// Consistency selects how fresh the result of a read has to be.
+type Consistency string
+
+const (
+	// ConsistencyLinearizable reads go through the dqlite leader and see every committed change.
+	ConsistencyLinearizable Consistency = "linearizable"
+
+	// ConsistencyStale reads may be served from the result of an earlier read on this member, up to
+	// StaleReadMaxAge old, sparing the round-trip to the dqlite leader.
+	ConsistencyStale Consistency = "stale"
+)
+
+// StaleReadMaxAge is how old the result of a ConsistencyStale read may be.
+const StaleReadMaxAge = 5 * time.Second
+
+// ParseConsistency returns the Consistency named by value, ConsistencyLinearizable when value is empty.
+func ParseConsistency(value string) (Consistency, error) {
+	switch Consistency(value) {
+	case "", ConsistencyLinearizable:
+		return ConsistencyLinearizable, nil
+	case ConsistencyStale:
+		return ConsistencyStale, nil
+	default:
+		return "", api.StatusErrorf(http.StatusBadRequest, "Invalid read consistency %q", value)
+	}
+}
+
+// maxStaleReads is how many results are kept for ConsistencyStale reads, across all members served by this
+// process. On reaching it, every expired result is evicted and, if none was, the oldest one.
+const maxStaleReads = 64
+
+// staleReadKey identifies a read kept for ConsistencyStale reads, made by member.
+type staleReadKey struct {
+	member string
+	key    string
+}
+
+// staleRead is the result of a read kept for ConsistencyStale reads.
+type staleRead struct {
+	value  any
+	readAt time.Time
+}
+
+// staleReads maps the reads to their last result. Only results holding no secrets may be kept: a listing
+// holds decrypted tokens and is never read stale.
+var staleReads = map[staleReadKey]staleRead{}
+var staleReadsMu sync.Mutex
+
+// consistentRead returns the result of read, the read identified by key on the member of s. With ConsistencyStale,
+// the last result of the same read is returned instead if it is less than StaleReadMaxAge old and no juju user was
+// written through this member since. Writes through other members are only seen once the result expires.
+// Every read refreshes that result, which may be shared with other callers and must not be modified.
+func consistentRead[T any](s *state.State, consistency Consistency, key string, read func() (T, error)) (T, error) {
+	cacheKey := staleReadKey{member: s.Name(), key: key}
+	if consistency == ConsistencyStale {
+		staleReadsMu.Lock()
+		cached, ok := staleReads[cacheKey]
+		staleReadsMu.Unlock()
+
+		if ok && time.Since(cached.readAt) < StaleReadMaxAge {
+			value, ok := cached.value.(T)
+			if ok {
+				return value, nil
+			}
+		}
+	}
+
+	readAt := time.Now()
+	value, err := read()
+	if err != nil {
+		return value, err
+	}
+
+	staleReadsMu.Lock()
+	defer staleReadsMu.Unlock()
+
+	_, ok := staleReads[cacheKey]
+	if !ok && len(staleReads) >= maxStaleReads {
+		evictStaleReads()
+	}
+
+	staleReads[cacheKey] = staleRead{value: value, readAt: readAt}
+
+	return value, nil
+}
+
+// evictStaleReads removes the expired results from staleReads, or the oldest one if none expired.
+// staleReadsMu must be held.
+func evictStaleReads() {
+	var oldest staleReadKey
+	var oldestAt time.Time
+	for k, cached := range staleReads {
+		if time.Since(cached.readAt) >= StaleReadMaxAge {
+			delete(staleReads, k)
+			continue
+		}
+
+		if oldestAt.IsZero() || cached.readAt.Before(oldestAt) {
+			oldest = k
+			oldestAt = cached.readAt
+		}
+	}
+
+	if len(staleReads) >= maxStaleReads {
+		delete(staleReads, oldest)
+	}
+}
+
+// invalidateStaleReads drops the results kept for the reads made by member, once it wrote juju users.
+func invalidateStaleReads(member string) {
+	staleReadsMu.Lock()
+	defer staleReadsMu.Unlock()
+
+	for k := range staleReads {
+		if k.member == member {
+			delete(staleReads, k)
+		}
+	}
+}
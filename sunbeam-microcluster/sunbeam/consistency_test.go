@@ -0,0 +1,119 @@
+package sunbeam
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/canonical/microcluster/state"
+)
+
+// newTestState returns a state for the cluster member name, enough for the reads that only need its name.
+func newTestState(name string) *state.State {
+	return &state.State{Name: func() string { return name }}
+}
+
+// resetStaleReads empties staleReads now and when the test ends.
+func resetStaleReads(t *testing.T) {
+	t.Helper()
+
+	staleReadsMu.Lock()
+	staleReads = map[staleReadKey]staleRead{}
+	staleReadsMu.Unlock()
+
+	t.Cleanup(func() {
+		staleReadsMu.Lock()
+		staleReads = map[staleReadKey]staleRead{}
+		staleReadsMu.Unlock()
+	})
+}
+
+// countingRead returns a read returning how many times it was called.
+func countingRead() func() (int, error) {
+	calls := 0
+	return func() (int, error) {
+		calls++
+		return calls, nil
+	}
+}
+
+func TestConsistentReadStale(t *testing.T) {
+	resetStaleReads(t)
+
+	s := newTestState("member-1")
+	read := countingRead()
+
+	for i, test := range []struct {
+		consistency Consistency
+		want        int
+	}{
+		{consistency: ConsistencyStale, want: 1},
+		{consistency: ConsistencyStale, want: 1},
+		{consistency: ConsistencyLinearizable, want: 2},
+		{consistency: ConsistencyStale, want: 2},
+	} {
+		got, err := consistentRead(s, test.consistency, "key", read)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != test.want {
+			t.Errorf("Read %d: expected %d, got %d", i, test.want, got)
+		}
+	}
+}
+
+func TestConsistentReadPerMember(t *testing.T) {
+	resetStaleReads(t)
+
+	read := countingRead()
+
+	first, _ := consistentRead(newTestState("member-1"), ConsistencyStale, "key", read)
+	second, _ := consistentRead(newTestState("member-2"), ConsistencyStale, "key", read)
+	if first == second {
+		t.Fatalf("Expected member-2 not to see the read of member-1")
+	}
+}
+
+func TestInvalidateStaleReads(t *testing.T) {
+	resetStaleReads(t)
+
+	s1 := newTestState("member-1")
+	s2 := newTestState("member-2")
+	read := countingRead()
+
+	_, _ = consistentRead(s1, ConsistencyStale, "key", read)
+	_, _ = consistentRead(s2, ConsistencyStale, "key", read)
+
+	invalidateStaleReads("member-1")
+
+	got, _ := consistentRead(s1, ConsistencyStale, "key", read)
+	if got != 3 {
+		t.Errorf("Expected member-1 to read again after a write, got result %d", got)
+	}
+
+	got, _ = consistentRead(s2, ConsistencyStale, "key", read)
+	if got != 2 {
+		t.Errorf("Expected member-2 to keep its stale read, got result %d", got)
+	}
+}
+
+func TestStaleReadsBounded(t *testing.T) {
+	resetStaleReads(t)
+
+	s := newTestState("member-1")
+	for i := 0; i < 2*maxStaleReads; i++ {
+		_, _ = consistentRead(s, ConsistencyStale, fmt.Sprintf("key-%d", i), countingRead())
+	}
+
+	staleReadsMu.Lock()
+	defer staleReadsMu.Unlock()
+
+	if len(staleReads) > maxStaleReads {
+		t.Fatalf("Expected at most %d stale reads, got %d", maxStaleReads, len(staleReads))
+	}
+
+	_, ok := staleReads[staleReadKey{member: "member-1", key: fmt.Sprintf("key-%d", 2*maxStaleReads-1)}]
+	if !ok {
+		t.Errorf("Expected the latest read to be kept")
+	}
+}
@@ -0,0 +1,42 @@
+package sunbeam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/state"
+)
+
+// ExperimentalConfigNamespace is the config namespace of the feature gates of the experimental APIs.
+const ExperimentalConfigNamespace = "experimental"
+
+// ExperimentalJujuUserBatch gates the juju user batch APIs.
+const ExperimentalJujuUserBatch = ExperimentalConfigNamespace + ".jujuuser-batch"
+
+func init() {
+	RegisterConfigSchema(ExperimentalConfigNamespace, map[string]ConfigKeySchema{
+		ExperimentalJujuUserBatch: {Type: ConfigTypeBoolean},
+	})
+}
+
+// FeatureEnabled returns whether the experimental feature gated by the config key feature is enabled, which
+// takes setting it to true. Features are disabled by default. The config is read on every call, so that
+// switching a gate takes effect right away without restarting the daemon.
+func FeatureEnabled(s *state.State, feature string) (bool, error) {
+	value, err := GetConfig(s, feature)
+	if api.StatusErrorCheck(err, http.StatusNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to get feature gate %q: %w", feature, err)
+	}
+
+	var enabled bool
+	err = json.Unmarshal([]byte(value), &enabled)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value for feature gate %q: %w", feature, err)
+	}
+
+	return enabled, nil
+}
@@ -0,0 +1,78 @@
+package sunbeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// JujuUserLister lists the users known to a Juju controller.
+type JujuUserLister interface {
+	ListUsers(ctx context.Context) ([]string, error)
+}
+
+// ReconcileWithJuju compares the stored juju users with the users listed by the controller and returns, sorted,
+// the usernames only stored in the database and the usernames only known to the controller
+// Nothing is changed on either side.
+func ReconcileWithJuju(ctx context.Context, s *state.State, lister JujuUserLister) ([]string, []string, error) {
+	// List the controller users first so the transaction is not held over the round trip.
+	jujuUsers, err := lister.ListUsers(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to list juju controller users: %w", err)
+	}
+
+	var missingInJuju, missingInDB []string
+	err = s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		missingInJuju, missingInDB, err = diffJujuUsers(ctx, database.NewJujuUserStore(tx), jujuUsers)
+
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return missingInJuju, missingInDB, nil
+}
+
+// diffJujuUsers returns, sorted, the usernames only held by store and the usernames only found in jujuUsers.
+func diffJujuUsers(ctx context.Context, store database.JujuUserStore, jujuUsers []string) ([]string, []string, error) {
+	records, err := store.GetJujuUsers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stored := map[string]bool{}
+	for _, record := range records {
+		stored[record.Username] = true
+	}
+
+	inJuju := map[string]bool{}
+	missingInDB := []string{}
+	for _, username := range jujuUsers {
+		if inJuju[username] {
+			continue
+		}
+
+		inJuju[username] = true
+		if !stored[username] {
+			missingInDB = append(missingInDB, username)
+		}
+	}
+
+	missingInJuju := []string{}
+	for username := range stored {
+		if !inJuju[username] {
+			missingInJuju = append(missingInJuju, username)
+		}
+	}
+
+	sort.Strings(missingInJuju)
+	sort.Strings(missingInDB)
+
+	return missingInJuju, missingInDB, nil
+}
@@ -3,7 +3,11 @@ package sunbeam
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/canonical/microcluster/state"
 
@@ -11,21 +15,182 @@ import (
 	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
 )
 
-// ListJujuUsers returns the jujuusers from the database
-func ListJujuUsers(s *state.State) (types.JujuUsers, error) {
+// tokenAgeSeconds returns the whole seconds elapsed since updatedAt
+func tokenAgeSeconds(updatedAt time.Time) int64 {
+	if updatedAt.IsZero() {
+		return 0
+	}
+
+	return int64(time.Since(updatedAt).Seconds())
+}
+
+// ListJujuUsers returns the jujuusers from the database ordered by the given sort field and order
+// Listings hold the tokens, so unlike the stats they are never served stale.
+func ListJujuUsers(s *state.State, sort string, order string) (types.JujuUsers, error) {
 	users := types.JujuUsers{}
 
 	// Get the juju users from the database.
 	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
-		records, err := database.GetJujuUsers(ctx, tx)
+		records, err := database.GetJujuUsersSorted(ctx, tx, sort, order)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range records {
+			users = append(users, jujuUserFromRecord(user))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// jujuUserFromRecord returns the API representation of the juju user record
+func jujuUserFromRecord(record database.JujuUser) types.JujuUser {
+	return types.JujuUser{
+		Username:         record.Username,
+		Token:            record.Token,
+		DisplayName:      record.DisplayName,
+		TokenFingerprint: record.TokenFingerprint,
+		TokenAgeSeconds:  tokenAgeSeconds(record.UpdatedAt),
+		TokenUnavailable: record.TokenUnavailable,
+	}
+}
+
+// WriteJujuUsersJSON writes the juju users to w as a JSON array in username order, one element per user as they
+// are read from the database, so that the whole list is never held in memory. If w can be flushed, every
+// element is flushed once written so that clients can start parsing right away.
+func WriteJujuUsersJSON(ctx context.Context, s *state.State, w io.Writer) error {
+	flusher, _ := w.(interface{ Flush() })
+
+	_, err := io.WriteString(w, "[")
+	if err != nil {
+		return err
+	}
+
+	first := true
+	err = s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return database.WalkJujuUsers(ctx, tx, func(record database.JujuUser) error {
+			data, err := json.Marshal(jujuUserFromRecord(record))
+			if err != nil {
+				return err
+			}
+
+			if !first {
+				_, err = io.WriteString(w, ",")
+				if err != nil {
+					return err
+				}
+			}
+
+			first = false
+
+			_, err = w.Write(data)
+			if err != nil {
+				return err
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+
+	return err
+}
+
+// ListJujuUsersByName returns the jujuusers with the given usernames ordered by username, repeated usernames
+// are only returned once and unknown ones are left out
+func ListJujuUsersByName(s *state.State, names []string) (types.JujuUsers, error) {
+	users := types.JujuUsers{}
+
+	err := database.CheckJujuUserBatchSize(len(names))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(names))
+	filters := make([]database.JujuUserFilter, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		filters = append(filters, database.JujuUserByUsername(name))
+	}
+
+	err = s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		records, err := database.GetJujuUsers(ctx, tx, filters...)
 		if err != nil {
-			return fmt.Errorf("Failed to fetch juju user: %w", err)
+			return err
 		}
 
 		for _, user := range records {
-			users = append(users, types.JujuUser{
-				Username: user.Username,
-				Token:    user.Token,
+			users = append(users, jujuUserFromRecord(user))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListJujuUsersPage returns up to limit jujuusers with a username after the given one
+func ListJujuUsersPage(s *state.State, after string, limit int) (types.JujuUserPage, error) {
+	page := types.JujuUserPage{Users: types.JujuUsers{}}
+
+	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		records, next, err := database.GetJujuUsersPage(ctx, tx, after, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range records {
+			page.Users = append(page.Users, jujuUserFromRecord(user))
+		}
+
+		page.Next = next
+
+		return nil
+	})
+	if err != nil {
+		return types.JujuUserPage{}, err
+	}
+
+	return page, nil
+}
+
+// ListJujuUserEvents returns up to limit juju user change events with a sequence after since
+func ListJujuUserEvents(s *state.State, since int64, limit int) ([]types.JujuUserEvent, error) {
+	events := []types.JujuUserEvent{}
+
+	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		records, err := database.GetOutboxEventsSince(ctx, tx, since, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range records {
+			events = append(events, types.JujuUserEvent{
+				Sequence: event.ID,
+				Username: event.Username,
+				Action:   event.Action,
+				Time:     event.CreatedAt,
 			})
 		}
 
@@ -35,20 +200,128 @@ func ListJujuUsers(s *state.State) (types.JujuUsers, error) {
 		return nil, err
 	}
 
+	return events, nil
+}
+
+// GetJujuUserStats returns a summary of the jujuusers table
+// With ConsistencyStale, the summary may be one computed recently.
+func GetJujuUserStats(s *state.State, consistency Consistency) (*types.JujuUserStats, error) {
+	return consistentRead(s, consistency, "jujuusers/stats", func() (*types.JujuUserStats, error) {
+		return getJujuUserStats(s)
+	})
+}
+
+// getJujuUserStats computes the summary of the jujuusers table
+func getJujuUserStats(s *state.State) (*types.JujuUserStats, error) {
+	stats := &types.JujuUserStats{}
+
+	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		record, err := database.GetJujuUserStats(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		stats.Total = record.Total
+		stats.EmptyTokens = record.EmptyTokens
+		if !record.OldestUpdatedAt.IsZero() {
+			stats.OldestUpdatedAt = &record.OldestUpdatedAt
+		}
+		if !record.NewestUpdatedAt.IsZero() {
+			stats.NewestUpdatedAt = &record.NewestUpdatedAt
+		}
+
+		lifetime, err := database.GetJujuUserLifetimeStats(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		stats.CreatedTotal = lifetime.Created
+		stats.DeletedTotal = lifetime.Deleted
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// jujuUsersCSVHeader are the columns of the CSV export of the juju users, tokens are never exported.
+var jujuUsersCSVHeader = []string{"username", "created_at", "updated_at"}
+
+// WriteJujuUsersCSV writes the juju users to w as CSV, one row per user as they are read from the database
+func WriteJujuUsersCSV(ctx context.Context, s *state.State, w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+
+	err := csvWriter.Write(jujuUsersCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	err = s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return database.WalkJujuUsers(ctx, tx, func(user database.JujuUser) error {
+			return csvWriter.Write([]string{user.Username, user.CreatedAt.UTC().Format(time.RFC3339), user.UpdatedAt.UTC().Format(time.RFC3339)})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+// SearchJujuUsers returns the jujuusers whose display name contains text
+func SearchJujuUsers(s *state.State, text string) (types.JujuUsers, error) {
+	users := types.JujuUsers{}
+
+	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
+		records, err := database.SearchJujuUsersByDisplayName(ctx, tx, text)
+		if err != nil {
+			return fmt.Errorf("Failed to search juju users: %w", err)
+		}
+
+		for _, user := range records {
+			users = append(users, jujuUserFromRecord(user))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return users, nil
 }
 
 // GetJujuUser returns a JujuUser with the given name
-func GetJujuUser(s *state.State, name string) (types.JujuUser, error) {
+// If suggest is set and the juju user does not exist, the error suggests the closest existing names.
+func GetJujuUser(s *state.State, name string, suggest bool) (types.JujuUser, error) {
 	jujuUser := types.JujuUser{}
 	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
-		record, err := database.GetJujuUser(ctx, tx, name)
+		var record *database.JujuUser
+		var err error
+		if suggest {
+			record, err = database.GetJujuUserWithSuggestions(ctx, tx, name, database.DefaultJujuUsernameSuggestions)
+		} else {
+			record, err = database.GetJujuUser(ctx, tx, name)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = record.TokenErr()
 		if err != nil {
 			return err
 		}
 
 		jujuUser.Username = record.Username
 		jujuUser.Token = record.Token
+		jujuUser.DisplayName = record.DisplayName
+		jujuUser.TokenFingerprint = record.TokenFingerprint
+		jujuUser.TokenAgeSeconds = tokenAgeSeconds(record.UpdatedAt)
 
 		return nil
 	})
@@ -56,16 +329,65 @@ func GetJujuUser(s *state.State, name string) (types.JujuUser, error) {
 	return jujuUser, err
 }
 
+// GetJujuUserDetail returns a JujuUser with the given name along with its roles, labels and services
+// Everything is read within one transaction, so the detail is consistent.
+func GetJujuUserDetail(s *state.State, name string) (types.JujuUserDetail, error) {
+	detail := types.JujuUserDetail{}
+
+	err := readTransaction(s.Context, s,
+		func(ctx context.Context, tx *sql.Tx) error {
+			record, err := database.GetJujuUserWithServices(ctx, tx, name)
+			if err != nil {
+				return err
+			}
+
+			err = record.TokenErr()
+			if err != nil {
+				return err
+			}
+
+			detail.Username = record.Username
+			detail.Token = record.Token
+			detail.DisplayName = record.DisplayName
+			detail.TokenFingerprint = record.TokenFingerprint
+			detail.TokenAgeSeconds = tokenAgeSeconds(record.UpdatedAt)
+			detail.Services = record.Services
+
+			return nil
+		},
+		func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			detail.Roles, err = database.GetJujuUserRoles(ctx, tx, name)
+
+			return err
+		},
+		func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			detail.Labels, err = database.GetJujuUserLabels(ctx, tx, name)
+
+			return err
+		},
+	)
+	if err != nil {
+		return types.JujuUserDetail{}, err
+	}
+
+	return detail, nil
+}
+
 // AddJujuUser adds a Jujuuser to the database
-func AddJujuUser(s *state.State, name string, token string) error {
-	// Add juju user to the database.
-	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
-		_, err := database.CreateJujuUser(ctx, tx, database.JujuUser{Username: name, Token: token})
-		if err != nil {
-			return fmt.Errorf("Failed to record juju user: %w", err)
-		}
+// Changes are attributed to the actor stored in ctx, see database.WithActor.
+func AddJujuUser(ctx context.Context, s *state.State, name string, token string, displayName string) error {
+	// Add juju user to the database, telling the client to try again if concurrent provisioning keeps it busy.
+	err := busyUnavailable(func() error {
+		return jujuUserWriteTransaction(ctx, s, "create", func(ctx context.Context, tx *sql.Tx) error {
+			_, err := database.CreateJujuUser(ctx, tx, database.JujuUser{Username: name, Token: token, DisplayName: displayName})
+			if err != nil {
+				return fmt.Errorf("Failed to record juju user: %w", err)
+			}
 
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
 		return err
@@ -74,11 +396,73 @@ func AddJujuUser(s *state.State, name string, token string) error {
 	return nil
 }
 
+// AddJujuUsers adds each of the juju users to the database and returns the outcome of every one of them
+// Every user is added in its own transaction so that a failing user does not prevent adding the others.
+// Batches larger than the configured maximum batch size are rejected as a whole.
+func AddJujuUsers(ctx context.Context, s *state.State, users types.JujuUsers) ([]types.JujuUserBatchResult, error) {
+	err := database.CheckJujuUserBatchSize(len(users))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]types.JujuUserBatchResult, 0, len(users))
+
+	for _, user := range users {
+		result := types.JujuUserBatchResult{Username: user.Username}
+
+		err := AddJujuUser(ctx, s, user.Username, user.Token, user.DisplayName)
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// PatchJujuUser updates the fields of the juju user set in patch, keeping the current value of the others
+func PatchJujuUser(ctx context.Context, s *state.State, name string, patch types.JujuUserPatch) error {
+	unlock := jujuUserLocks.Lock(name)
+	defer unlock()
+
+	return jujuUserWriteTransaction(ctx, s, "patch", func(ctx context.Context, tx *sql.Tx) error {
+		// Serialize with concurrent updates of the same user so that none of them is lost.
+		err := database.LockJujuUser(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		record, err := database.GetJujuUser(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		if patch.Username != nil {
+			record.Username = *patch.Username
+		}
+		if patch.Token != nil {
+			record.Token = *patch.Token
+		}
+		if patch.DisplayName != nil {
+			record.DisplayName = *patch.DisplayName
+		}
+
+		err = database.UpdateJujuUser(ctx, tx, name, *record)
+		if err != nil {
+			return fmt.Errorf("Failed to update juju user: %w", err)
+		}
+
+		return nil
+	})
+}
+
 // DeleteJujuUser deletes the juju user record from the database
-func DeleteJujuUser(s *state.State, name string) error {
+// The last juju user with the admin role is only deleted when force is set.
+func DeleteJujuUser(ctx context.Context, s *state.State, name string, force bool) error {
 	// Delete juju user from the database.
-	err := s.Database.Transaction(s.Context, func(ctx context.Context, tx *sql.Tx) error {
-		err := database.DeleteJujuUser(ctx, tx, name)
+	err := jujuUserWriteTransaction(ctx, s, "delete", func(ctx context.Context, tx *sql.Tx) error {
+		err := database.DeleteJujuUserWithOptions(ctx, tx, name, database.DeleteJujuUserOptions{Force: force})
 		if err != nil {
 			return fmt.Errorf("Failed to delete juju user: %w", err)
 		}
@@ -91,3 +475,104 @@ func DeleteJujuUser(s *state.State, name string) error {
 
 	return nil
 }
+
+// DeleteJujuUsers deletes the juju users and returns whether each of them was deleted or already absent.
+// A service unavailable error is returned if the database stays busy.
+func DeleteJujuUsers(ctx context.Context, s *state.State, names []string) (map[string]string, error) {
+	var outcomes map[string]string
+
+	err := busyUnavailable(func() error {
+		return jujuUserWriteTransaction(ctx, s, "delete-batch", func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			outcomes, err = database.DeleteJujuUsersDetailed(ctx, tx, names)
+			if err != nil {
+				return fmt.Errorf("Failed to delete juju users: %w", err)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// UpdateJujuUserToken replaces the token of the juju user
+func UpdateJujuUserToken(ctx context.Context, s *state.State, name string, token string) error {
+	unlock := jujuUserLocks.Lock(name)
+	defer unlock()
+
+	return jujuUserWriteTransaction(ctx, s, "update-token", func(ctx context.Context, tx *sql.Tx) error {
+		_, err := database.UpdateJujuUserTokens(ctx, tx, map[string]string{name: token}, false)
+
+		return err
+	})
+}
+
+// CompareAndSetJujuUserToken replaces the token of the juju user with newToken if it currently is oldToken
+// It returns whether the token was replaced.
+func CompareAndSetJujuUserToken(ctx context.Context, s *state.State, name string, oldToken string, newToken string) (bool, error) {
+	unlock := jujuUserLocks.Lock(name)
+	defer unlock()
+
+	var swapped bool
+	err := jujuUserWriteTransaction(ctx, s, "compare-and-set-token", func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		swapped, err = database.CompareAndSetJujuUserToken(ctx, tx, name, oldToken, newToken)
+
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return swapped, nil
+}
+
+// jujuUserTokenGenerator mints the tokens of the juju users created or rotated by the daemon.
+var jujuUserTokenGenerator database.TokenGenerator = database.RandomTokenGenerator{}
+
+// GenerateJujuUser adds a juju user with a freshly generated token to the database and returns the token
+func GenerateJujuUser(ctx context.Context, s *state.State, name string) (string, error) {
+	var token string
+
+	err := busyUnavailable(func() error {
+		return jujuUserWriteTransaction(ctx, s, "create", func(ctx context.Context, tx *sql.Tx) error {
+			user, err := database.GenerateAndCreateJujuUser(ctx, tx, name, jujuUserTokenGenerator)
+			if err != nil {
+				return fmt.Errorf("Failed to record juju user: %w", err)
+			}
+
+			token = user.Token
+
+			return nil
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RotateJujuUserTokens replaces the tokens of all juju users with freshly generated ones
+func RotateJujuUserTokens(ctx context.Context, s *state.State) (int, error) {
+	var rotated int
+
+	err := jujuUserWriteTransaction(ctx, s, "rotate", func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		rotated, err = database.RotateAllJujuUserTokens(ctx, tx, jujuUserTokenGenerator.GenerateToken)
+		if err != nil {
+			return fmt.Errorf("Failed to rotate juju user tokens: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rotated, nil
+}
@@ -0,0 +1,52 @@
+package sunbeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// JujuDialer logs in to a Juju controller.
+type JujuDialer interface {
+	// Login attempts a lightweight login with the given credentials. It returns whether the controller
+	// accepted them, errors are reserved for failing to reach the controller.
+	Login(ctx context.Context, username string, token string) (bool, error)
+}
+
+// VerifyJujuUser checks the stored token of the juju user still authenticates against the controller reached through dialer
+func VerifyJujuUser(ctx context.Context, s *state.State, username string, dialer JujuDialer) (bool, error) {
+	var token string
+
+	// Only hold the transaction for the lookup, not for the login round trip.
+	err := s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		token, err = database.GetJujuUserToken(ctx, tx, username)
+
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := dialer.Login(ctx, username, token)
+	if err != nil {
+		return false, fmt.Errorf("Failed to login to juju controller as %q: %w", username, err)
+	}
+
+	if !ok {
+		return false, nil
+	}
+
+	err = s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return database.TouchJujuUser(ctx, tx, username)
+	})
+	if err != nil {
+		return true, fmt.Errorf("Failed to record use of juju user %q: %w", username, err)
+	}
+
+	return true, nil
+}
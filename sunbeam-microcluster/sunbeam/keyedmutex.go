@@ -0,0 +1,53 @@
+package sunbeam
+
+import (
+	"sync"
+)
+
+// keyedMutex serializes callers per key while callers with different keys proceed concurrently.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the lock of a single key, refs counts its holders and waiters.
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock locks key and returns the function that unlocks it.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		// Drop unused locks so the map does not grow with every username ever seen.
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// jujuUserLocks serializes the token changes of a juju user within the daemon, the database write lock
+// taken within the transaction serializes them across cluster members.
+var jujuUserLocks keyedMutex
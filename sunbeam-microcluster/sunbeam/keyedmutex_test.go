@@ -0,0 +1,88 @@
+package sunbeam
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesKey(t *testing.T) {
+	var k keyedMutex
+	var holders atomic.Int32
+	var overlaps atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				unlock := k.Lock("alice")
+				if holders.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+
+				time.Sleep(10 * time.Microsecond)
+				holders.Add(-1)
+				unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if overlaps.Load() != 0 {
+		t.Fatalf("Expected the key to be held by one caller at a time, it was shared %d times", overlaps.Load())
+	}
+
+	if len(k.locks) != 0 {
+		t.Fatalf("Expected unused locks to be dropped, %d remain", len(k.locks))
+	}
+}
+
+func TestKeyedMutexIndependentKeys(t *testing.T) {
+	var k keyedMutex
+
+	unlock := k.Lock("alice")
+	defer unlock()
+
+	locked := make(chan struct{})
+	go func() {
+		k.Lock("bob")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a different key to be locked while alice is held")
+	}
+}
+
+func TestKeyedMutexWaitsForHolder(t *testing.T) {
+	var k keyedMutex
+
+	unlock := k.Lock("alice")
+
+	locked := make(chan struct{})
+	go func() {
+		k.Lock("alice")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected the second caller to wait for alice to be unlocked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the second caller to lock alice once unlocked")
+	}
+}
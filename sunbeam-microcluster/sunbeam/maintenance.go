@@ -0,0 +1,36 @@
+package sunbeam
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/api/types"
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// jujuUserMaintenanceMu is held while the juju user maintenance runs on this member.
+var jujuUserMaintenanceMu sync.Mutex
+
+// MaintainJujuUsers runs the security maintenance of the juju users and reports the completed steps
+// Only one maintenance runs at a time, a conflict error is returned while another one is running.
+// A failed maintenance resumes where it failed when run again, the steps completed before are still reported.
+func MaintainJujuUsers(ctx context.Context, s *state.State) (types.JujuUserMaintenance, error) {
+	if !jujuUserMaintenanceMu.TryLock() {
+		return types.JujuUserMaintenance{}, api.StatusErrorf(http.StatusConflict, "Juju user maintenance is already running")
+	}
+
+	defer jujuUserMaintenanceMu.Unlock()
+
+	steps, err := database.MaintainJujuUsers(ctx, database.AuditedTransactor(s.Database.Transaction))
+
+	report := types.JujuUserMaintenance{Steps: make([]types.JujuUserMaintenanceStep, 0, len(steps))}
+	for _, step := range steps {
+		report.Steps = append(report.Steps, types.JujuUserMaintenanceStep{Name: step.Name, Changed: step.Changed})
+	}
+
+	return report, err
+}
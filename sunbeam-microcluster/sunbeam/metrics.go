@@ -0,0 +1,119 @@
+package sunbeam
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/canonical/microcluster/state"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// jujuUserLockWaitBuckets are the upper bounds, in seconds, of the buckets of the juju user write wait histogram.
+var jujuUserLockWaitBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into cumulative buckets, the shape of a Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe records one observation of value.
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// jujuUserLockWait holds, by operation, how long juju user writes waited for their transaction.
+var jujuUserLockWait = map[string]*histogram{}
+var jujuUserLockWaitMu sync.Mutex
+
+// observeJujuUserLockWait records that a juju user write of the given operation waited for wait.
+func observeJujuUserLockWait(operation string, wait time.Duration) {
+	jujuUserLockWaitMu.Lock()
+	defer jujuUserLockWaitMu.Unlock()
+
+	h, ok := jujuUserLockWait[operation]
+	if !ok {
+		h = &histogram{bounds: jujuUserLockWaitBuckets, counts: make([]uint64, len(jujuUserLockWaitBuckets))}
+		jujuUserLockWait[operation] = h
+	}
+
+	h.observe(wait.Seconds())
+}
+
+// jujuUserWriteTransaction runs the juju user write f of the given operation in a transaction and records how
+// long it took from starting the transaction until f returned. Transactions only take the dqlite write lock with
+// their first write, so this is dominated by the wait for the lock held by concurrent writers.
+// The audit events of f are only sent, and the stale reads of the member dropped, once the transaction is committed.
+func jujuUserWriteTransaction(ctx context.Context, s *state.State, operation string, f func(ctx context.Context, tx *sql.Tx) error) error {
+	started := time.Now()
+
+	err := database.AuditedTransactor(s.Database.Transaction)(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		err := f(ctx, tx)
+		observeJujuUserLockWait(operation, time.Since(started))
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	invalidateStaleReads(s.Name())
+
+	return nil
+}
+
+// WriteJujuUserMetrics writes the juju user metrics to w in the Prometheus text exposition format.
+func WriteJujuUserMetrics(w io.Writer) error {
+	jujuUserLockWaitMu.Lock()
+	defer jujuUserLockWaitMu.Unlock()
+
+	operations := make([]string, 0, len(jujuUserLockWait))
+	for operation := range jujuUserLockWait {
+		operations = append(operations, operation)
+	}
+
+	sort.Strings(operations)
+
+	_, err := fmt.Fprint(w, "# HELP sunbeam_jujuuser_lock_wait_seconds Time juju user writes waited for their transaction.\n# TYPE sunbeam_jujuuser_lock_wait_seconds histogram\n")
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range operations {
+		h := jujuUserLockWait[operation]
+		for i, bound := range h.bounds {
+			_, err = fmt.Fprintf(w, "sunbeam_jujuuser_lock_wait_seconds_bucket{operation=%q,le=%q} %d\n", operation, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "sunbeam_jujuuser_lock_wait_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", operation, h.count)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "sunbeam_jujuuser_lock_wait_seconds_sum{operation=%q} %s\nsunbeam_jujuuser_lock_wait_seconds_count{operation=%q} %d\n", operation, strconv.FormatFloat(h.sum, 'g', -1, 64), operation, h.count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package sunbeam
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/canonical/lxd/shared/logger"
+
+	"github.com/canonical/snap-openstack/sunbeam-microcluster/database"
+)
+
+// DefaultOutboxDrainConcurrency is how many usernames an OutboxDrainer delivers events of in parallel by default.
+const DefaultOutboxDrainConcurrency = 4
+
+// DefaultOutboxDrainMaxInFlight is how many outbox events an OutboxDrainer takes on per round by default.
+const DefaultOutboxDrainMaxInFlight = 100
+
+// DefaultOutboxDeliveryRetries is how many times an OutboxDrainer retries a failed delivery by default before
+// recording the failure, see database.RecordOutboxFailure.
+const DefaultOutboxDeliveryRetries = 3
+
+// DefaultOutboxDeliveryRetryDelay is the delay before the first delivery retry, doubling with every following one.
+const DefaultOutboxDeliveryRetryDelay = 200 * time.Millisecond
+
+// OutboxDeliverer delivers an outbox event to the external sync target.
+type OutboxDeliverer func(ctx context.Context, event database.OutboxEvent) error
+
+// OutboxDrainer delivers the pending outbox events with Deliver, in order per username while the events of
+// different usernames are delivered concurrently. Zero fields use their default.
+//
+// Backpressure comes from the pending events being taken on by rounds of at most MaxInFlight, a round only
+// starting once the target settled all the events of the previous one, while at most Concurrency deliveries
+// are running at any time.
+type OutboxDrainer struct {
+	Deliver     OutboxDeliverer
+	Concurrency int
+	MaxInFlight int
+
+	// Retries and RetryDelay control the jittered exponential backoff of failed deliveries.
+	Retries    int
+	RetryDelay time.Duration
+
+	// mu serializes the rounds, as concurrent ones would deliver the events of a username out of order.
+	mu sync.Mutex
+}
+
+// outboxDrainResult gathers the outcome of the deliveries of a round.
+type outboxDrainResult struct {
+	mu        sync.Mutex
+	delivered int
+	err       error
+}
+
+// add records the outcome of the deliveries of a username.
+func (r *outboxDrainResult) add(delivered int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delivered += delivered
+	r.err = errors.Join(r.err, err)
+}
+
+// Drain runs a single round and returns the number of events delivered. The events of a username that keep
+// failing are left pending, after the failure is recorded, so that its following events wait for the next
+// round and are never delivered ahead of it. An event failing too many rounds is dead-lettered, which lets
+// the following events of the username through.
+func (d *OutboxDrainer) Drain(ctx context.Context, transaction database.Transactor) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	concurrency := d.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultOutboxDrainConcurrency
+	}
+
+	maxInFlight := d.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultOutboxDrainMaxInFlight
+	}
+
+	var events []database.OutboxEvent
+	err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		events, err = database.GetPendingOutboxEvents(ctx, tx, maxInFlight)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Group the events per username, keeping them oldest first.
+	usernames := []string{}
+	queues := map[string][]database.OutboxEvent{}
+	for _, event := range events {
+		_, ok := queues[event.Username]
+		if !ok {
+			usernames = append(usernames, event.Username)
+		}
+
+		queues[event.Username] = append(queues[event.Username], event)
+	}
+
+	result := &outboxDrainResult{}
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for _, username := range usernames {
+		queue := queues[username]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result.add(d.drainQueue(ctx, transaction, slots, queue))
+		}()
+	}
+
+	wg.Wait()
+
+	return result.delivered, result.err
+}
+
+// drainQueue delivers the events of a single username in order, holding a slot for every delivery.
+// It stops at the first event left pending.
+func (d *OutboxDrainer) drainQueue(ctx context.Context, transaction database.Transactor, slots chan struct{}, queue []database.OutboxEvent) (int, error) {
+	delivered := 0
+	for _, event := range queue {
+		select {
+		case <-ctx.Done():
+			return delivered, ctx.Err()
+		case slots <- struct{}{}:
+		}
+
+		deliveryErr := d.deliver(ctx, event)
+		<-slots
+
+		if deliveryErr == nil {
+			err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+				return database.MarkOutboxProcessed(ctx, tx, event.ID)
+			})
+			if err != nil {
+				return delivered, err
+			}
+
+			delivered++
+
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+
+		var deadLettered bool
+		err := transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			var err error
+			deadLettered, err = database.RecordOutboxFailure(ctx, tx, event.ID, deliveryErr.Error())
+
+			return err
+		})
+		if err != nil {
+			return delivered, err
+		}
+
+		if !deadLettered {
+			logger.Warn("Failed to deliver outbox event, retrying on the next round", logger.Ctx{"id": event.ID, "username": event.Username, "err": deliveryErr})
+
+			return delivered, nil
+		}
+
+		logger.Error("Failed to deliver outbox event, moved to the dead letters", logger.Ctx{"id": event.ID, "username": event.Username, "err": deliveryErr})
+	}
+
+	return delivered, nil
+}
+
+// deliver delivers event, retrying failed deliveries with a jittered exponential backoff.
+func (d *OutboxDrainer) deliver(ctx context.Context, event database.OutboxEvent) error {
+	retries := d.Retries
+	if retries <= 0 {
+		retries = DefaultOutboxDeliveryRetries
+	}
+
+	delay := d.RetryDelay
+	if delay <= 0 {
+		delay = DefaultOutboxDeliveryRetryDelay
+	}
+
+	var err error
+	for i := 0; i <= retries; i++ {
+		err = d.Deliver(ctx, event)
+		if err == nil || i == retries {
+			break
+		}
+
+		logger.Debug("Failed to deliver outbox event, retrying", logger.Ctx{"id": event.ID, "attempt": i + 1, "err": err})
+
+		// Sleep between half and the full delay.
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+	}
+
+	return err
+}
+
+// Run drains the outbox until ctx is done. Rounds follow each other right away as long as they are full,
+// otherwise the drainer waits for interval before the next one. Failed rounds are logged and retried.
+func (d *OutboxDrainer) Run(ctx context.Context, transaction database.Transactor, interval time.Duration) {
+	maxInFlight := d.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultOutboxDrainMaxInFlight
+	}
+
+	for {
+		delivered, err := d.Drain(ctx, transaction)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("Failed to drain the juju user outbox", logger.Ctx{"err": err})
+		}
+
+		if err == nil && delivered == maxInFlight {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package sunbeam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/lxd/shared/api"
+	"github.com/canonical/microcluster/state"
+)
+
+// JujuUserConfigNamespace is the config namespace of the juju user settings.
+const JujuUserConfigNamespace = "jujuuser"
+
+// JujuUserWriteRate is the config key of the juju user write requests allowed per second, 0 for unlimited.
+const JujuUserWriteRate = JujuUserConfigNamespace + ".write-rate"
+
+// JujuUserWriteBurst is the config key of the juju user write requests allowed in a burst.
+const JujuUserWriteBurst = JujuUserConfigNamespace + ".write-burst"
+
+func init() {
+	RegisterConfigSchema(JujuUserConfigNamespace, map[string]ConfigKeySchema{
+		JujuUserWriteRate:  {Type: ConfigTypeNumber},
+		JujuUserWriteBurst: {Type: ConfigTypeInteger},
+	})
+}
+
+// GetJujuUserWriteRate returns the juju user write rate and burst set in the cluster config, rate and burst
+// being returned for the keys that are not set.
+func GetJujuUserWriteRate(s *state.State, rate float64, burst int) (float64, int, error) {
+	err := getConfigValue(s, JujuUserWriteRate, &rate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = getConfigValue(s, JujuUserWriteBurst, &burst)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rate, burst, nil
+}
+
+// getConfigValue decodes the JSON value of the config key into value, which is left as is if key is not set.
+func getConfigValue(s *state.State, key string, value any) error {
+	encoded, err := GetConfig(s, key)
+	if api.StatusErrorCheck(err, http.StatusNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to get config key %q: %w", key, err)
+	}
+
+	err = json.Unmarshal([]byte(encoded), value)
+	if err != nil {
+		return fmt.Errorf("Invalid value for config key %q: %w", key, err)
+	}
+
+	return nil
+}
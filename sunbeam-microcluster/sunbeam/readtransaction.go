@@ -0,0 +1,24 @@
+package sunbeam
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/canonical/microcluster/state"
+)
+
+// readTransaction runs all of queries within a single database transaction, in order, so that they all read the
+// same snapshot of the database and only pay for one transaction. It stops at the first failing query and
+// returns its error; the transaction is rolled back on any error, and closed either way.
+func readTransaction(ctx context.Context, s *state.State, queries ...func(ctx context.Context, tx *sql.Tx) error) error {
+	return s.Database.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, query := range queries {
+			err := query(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
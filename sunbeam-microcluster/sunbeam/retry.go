@@ -0,0 +1,21 @@
+package sunbeam
+
+import (
+	"net/http"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// busyUnavailable runs f, a write going through s.Database.Transaction, and returns the busy or locked database
+// error it fails with as a service unavailable error so that clients know to try again later.
+// It doesn't retry f itself: Transaction already retries every error accepted by query.IsRetriableError with a
+// jittered delay, so a transient error reaching here means those retries were exhausted.
+func busyUnavailable(f func() error) error {
+	err := f()
+	if err != nil && query.IsRetriableError(err) {
+		return api.StatusErrorf(http.StatusServiceUnavailable, "Database is busy, try again later: %v", err)
+	}
+
+	return err
+}
@@ -0,0 +1,60 @@
+package sunbeam
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/canonical/lxd/lxd/db/query"
+	"github.com/canonical/lxd/shared/api"
+)
+
+var errLocked = errors.New("database is locked")
+
+// busyTimes returns a write failing with a locked database error n times before succeeding, counting its calls.
+func busyTimes(n int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= n {
+			return errLocked
+		}
+
+		return nil
+	}
+}
+
+func TestBusyUnavailableDoesNotMultiplyRetries(t *testing.T) {
+	calls := 0
+	write := busyTimes(2, &calls)
+
+	// query.Retry stands in for the retries of s.Database.Transaction.
+	err := busyUnavailable(func() error {
+		return query.Retry(context.Background(), func(context.Context) error { return write() })
+	})
+	if err != nil {
+		t.Fatalf("Expected the write to succeed: %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestBusyUnavailable(t *testing.T) {
+	calls := 0
+	err := busyUnavailable(busyTimes(1, &calls))
+	if !api.StatusErrorCheck(err, http.StatusServiceUnavailable) {
+		t.Fatalf("Expected a service unavailable error, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls)
+	}
+
+	errFailed := errors.New("failed")
+	err = busyUnavailable(func() error { return errFailed })
+	if !errors.Is(err, errFailed) {
+		t.Errorf("Expected other errors to be returned as is, got %v", err)
+	}
+}